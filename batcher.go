@@ -1,8 +1,12 @@
 package nakadi
 
 import (
+	"context"
+	"log/slog"
 	"reflect"
 	"time"
+
+	"github.com/pkg/errors"
 )
 
 // publishAPI defines interface that is used for publishing. Used because of unit tests
@@ -15,6 +19,9 @@ type publishAPI interface {
 // aggregate single events and publish them in batches.
 type BatchPublishAPI struct {
 	publishAPI             publishAPI
+	eventType              string
+	metrics                *clientMetrics
+	logger                 *slog.Logger
 	batchCollectionTimeout time.Duration
 	maxBatchSize           int
 	eventsChannel          chan *eventToPublish
@@ -62,6 +69,9 @@ func NewBatchPublishAPI(
 	batchOptions = batchOptions.withDefaults()
 	result := BatchPublishAPI{
 		publishAPI:             api,
+		eventType:              eventType,
+		metrics:                client.metrics,
+		logger:                 client.log().With("event_type", eventType),
 		batchCollectionTimeout: batchOptions.BatchCollectionTimeout,
 		maxBatchSize:           batchOptions.MaxBatchSize,
 		eventsChannel:          make(chan *eventToPublish, batchOptions.BatchQueueSize),
@@ -74,7 +84,18 @@ func NewBatchPublishAPI(
 // Publish will publish requested data through PublishApi. In case if it is a single event (not a slice), it will be
 // added to a batch and published as a part of a batch.
 func (p *BatchPublishAPI) Publish(event interface{}) error {
-	if reflect.TypeOf(event).Kind() == reflect.Slice {
+	return p.PublishContext(context.Background(), event)
+}
+
+// PublishContext works like Publish. In addition, if ctx carries a span context, it is propagated to the
+// consumers of the event via the metadata field span_ctx.
+func (p *BatchPublishAPI) PublishContext(ctx context.Context, event interface{}) error {
+	isBatch := reflect.TypeOf(event).Kind() == reflect.Slice
+	event, err := injectSpanContext(ctx, event)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode event")
+	}
+	if isBatch {
 		return p.publishAPI.Publish(event)
 	}
 	eventProxy := eventToPublish{
@@ -84,6 +105,7 @@ func (p *BatchPublishAPI) Publish(event interface{}) error {
 	}
 	defer close(eventProxy.publishResult)
 
+	p.metrics.addQueueDepth(p.eventType, 1)
 	p.eventsChannel <- &eventProxy
 	return <-eventProxy.publishResult
 }
@@ -107,6 +129,11 @@ func (p *BatchPublishAPI) publishBatchToNakadi(events []*eventToPublish) {
 		itemsToPublish[idx] = evt.event
 	}
 	err := p.publishAPI.Publish(itemsToPublish)
+	if err != nil {
+		p.logger.Warn("unable to publish batch", "batch_size", len(events), "error", err)
+	} else {
+		p.logger.Debug("batch published", "batch_size", len(events))
+	}
 	for _, evt := range events {
 		evt.publishResult <- err
 	}
@@ -129,6 +156,7 @@ func (p *BatchPublishAPI) dispatchThread() {
 			if !ok {
 				break
 			}
+			p.metrics.addQueueDepth(p.eventType, -1)
 			batch = append(batch, event)
 			finishAt := event.requestedAt.Add(p.batchCollectionTimeout)
 			finishBatchCollectionAt = &finishAt
@@ -141,6 +169,7 @@ func (p *BatchPublishAPI) dispatchThread() {
 					flush()
 				case evt, ok := <-p.eventsChannel:
 					if ok {
+						p.metrics.addQueueDepth(p.eventType, -1)
 						batch = append(batch, evt)
 						break
 					}
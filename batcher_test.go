@@ -174,6 +174,7 @@ func setupTestBatchPublisher(batchCollectionTimeout time.Duration, maxBatchSize
 	}
 	result := BatchPublishAPI{
 		publishAPI:             api,
+		logger:                 discardLogger,
 		maxBatchSize:           maxBatchSize,
 		batchCollectionTimeout: batchCollectionTimeout,
 		eventsChannel:          make(chan *eventToPublish, 1000),
@@ -0,0 +1,221 @@
+package nakadi
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenTimeout      = 30 * time.Second
+)
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed is the normal state of a circuit breaker in which all requests are sent to Nakadi.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen is the state in which requests fail immediately with a CircuitOpenError.
+	CircuitOpen
+	// CircuitHalfOpen is the state in which a limited number of requests is sent in order to probe
+	// whether Nakadi has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// CircuitOpenError is returned for requests that were not sent to Nakadi, because the circuit breaker
+// of the client is open.
+type CircuitOpenError struct {
+	// RetryAfter is the remaining time until the circuit breaker lets probe requests pass.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open, retry after %s", e.RetryAfter)
+}
+
+// CircuitBreakerOptions configures a circuit breaker, which protects the client from waiting for a
+// degraded Nakadi instance. The breaker opens after a number of consecutive failures, i.e. connection
+// errors or responses with a status code of 500 or above. While the breaker is open, requests fail
+// with a CircuitOpenError without retries. After OpenTimeout the breaker becomes half-open and lets
+// probe requests pass. A successful probe closes the breaker, a failed probe opens it again.
+type CircuitBreakerOptions struct {
+	// FailureThreshold is the number of consecutive failures after which the breaker opens (default: 5)
+	FailureThreshold int
+	// OpenTimeout is the time the breaker stays open before probe requests are allowed (default: 30s)
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests is the number of concurrent probe requests in the half-open state (default: 1)
+	HalfOpenMaxRequests int
+	// OnStateChange is called whenever the state of the breaker changes.
+	OnStateChange func(from, to CircuitState)
+}
+
+func (o *CircuitBreakerOptions) withDefaults() *CircuitBreakerOptions {
+	var copyOptions CircuitBreakerOptions
+	if o != nil {
+		copyOptions = *o
+	}
+	if copyOptions.FailureThreshold <= 0 {
+		copyOptions.FailureThreshold = defaultFailureThreshold
+	}
+	if copyOptions.OpenTimeout <= 0 {
+		copyOptions.OpenTimeout = defaultOpenTimeout
+	}
+	if copyOptions.HalfOpenMaxRequests <= 0 {
+		copyOptions.HalfOpenMaxRequests = 1
+	}
+	if copyOptions.OnStateChange == nil {
+		copyOptions.OnStateChange = func(_, _ CircuitState) {}
+	}
+	return &copyOptions
+}
+
+// newCircuitBreaker creates a circuit breaker. If options is nil, newCircuitBreaker returns nil, which
+// is a valid circuit breaker that is always closed.
+func newCircuitBreaker(options *CircuitBreakerOptions, logger *slog.Logger) *circuitBreaker {
+	if options == nil {
+		return nil
+	}
+	options = options.withDefaults()
+
+	return &circuitBreaker{
+		failureThreshold: options.FailureThreshold,
+		openTimeout:      options.OpenTimeout,
+		halfOpenMax:      options.HalfOpenMaxRequests,
+		onStateChange:    options.OnStateChange,
+		logger:           logger,
+		now:              time.Now}
+}
+
+// circuitBreaker implements a consecutive failures circuit breaker. A nil *circuitBreaker is valid and
+// lets all requests pass.
+type circuitBreaker struct {
+	sync.Mutex
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenMax      int
+	onStateChange    func(from, to CircuitState)
+	logger           *slog.Logger
+	now              func() time.Time
+
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// State returns the current state of the breaker.
+func (b *circuitBreaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == CircuitOpen && !b.now().Before(b.openedAt.Add(b.openTimeout)) {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// allow checks whether a request may pass. If so, the outcome of the request must be reported via done.
+func (b *circuitBreaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.Lock()
+	from := b.state
+
+	if b.state == CircuitOpen {
+		remaining := b.openedAt.Add(b.openTimeout).Sub(b.now())
+		if remaining > 0 {
+			b.Unlock()
+			return &CircuitOpenError{RetryAfter: remaining}
+		}
+		b.state = CircuitHalfOpen
+		b.probes = 0
+	}
+	if b.state == CircuitHalfOpen {
+		if b.probes >= b.halfOpenMax {
+			b.Unlock()
+			return &CircuitOpenError{}
+		}
+		b.probes++
+	}
+
+	to := b.state
+	b.Unlock()
+	b.notify(from, to)
+	return nil
+}
+
+// done records the outcome of a request which was allowed to pass. Canceled requests are neither
+// counted as success nor as failure.
+func (b *circuitBreaker) done(response *http.Response, err error) {
+	if b == nil {
+		return
+	}
+	b.Lock()
+	from := b.state
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		if b.state == CircuitHalfOpen && b.probes > 0 {
+			b.probes--
+		}
+	case err != nil || response.StatusCode >= 500:
+		b.failures++
+		if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.failureThreshold) {
+			b.state = CircuitOpen
+			b.openedAt = b.now()
+		}
+	default:
+		b.failures = 0
+		if b.state == CircuitHalfOpen {
+			b.state = CircuitClosed
+		}
+	}
+
+	to := b.state
+	b.Unlock()
+	b.notify(from, to)
+}
+
+// notify logs state changes and passes them to the OnStateChange callback.
+func (b *circuitBreaker) notify(from, to CircuitState) {
+	if from == to {
+		return
+	}
+	switch to {
+	case CircuitOpen:
+		b.logger.Warn("circuit breaker opened", "from", from.String(), "open_timeout", b.openTimeout)
+	default:
+		b.logger.Info("circuit breaker state changed", "from", from.String(), "to", to.String())
+	}
+	b.onStateChange(from, to)
+}
+
+// isCircuitOpen checks whether an error was caused by an open circuit breaker.
+func isCircuitOpen(err error) bool {
+	var circuitErr *CircuitOpenError
+	return errors.As(err, &circuitErr)
+}
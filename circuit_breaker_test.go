@@ -0,0 +1,115 @@
+package nakadi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitState_String(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+	assert.Equal(t, "CircuitState(7)", CircuitState(7).String())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2017, 8, 12, 7, 0, 0, 0, time.UTC)
+	failed := &http.Response{StatusCode: http.StatusServiceUnavailable}
+	succeeded := &http.Response{StatusCode: http.StatusOK}
+
+	var changes []CircuitState
+	breaker := newCircuitBreaker(&CircuitBreakerOptions{
+		FailureThreshold: 2,
+		OpenTimeout:      time.Minute,
+		OnStateChange:    func(_, to CircuitState) { changes = append(changes, to) },
+	}, discardLogger)
+	breaker.now = func() time.Time { return now }
+
+	t.Run("nil breaker", func(t *testing.T) {
+		var nilBreaker *circuitBreaker
+		assert.NoError(t, nilBreaker.allow())
+		nilBreaker.done(nil, assert.AnError)
+		assert.Equal(t, CircuitClosed, nilBreaker.State())
+	})
+
+	t.Run("success stays closed", func(t *testing.T) {
+		require.NoError(t, breaker.allow())
+		breaker.done(failed, nil)
+		require.NoError(t, breaker.allow())
+		breaker.done(succeeded, nil)
+		require.NoError(t, breaker.allow())
+		breaker.done(&http.Response{StatusCode: http.StatusNotFound}, nil)
+		require.NoError(t, breaker.allow())
+		breaker.done(nil, context.Canceled)
+
+		assert.Equal(t, CircuitClosed, breaker.State())
+		assert.Empty(t, changes)
+	})
+
+	t.Run("fail open after consecutive failures", func(t *testing.T) {
+		require.NoError(t, breaker.allow())
+		breaker.done(nil, assert.AnError)
+		require.NoError(t, breaker.allow())
+		breaker.done(failed, nil)
+
+		assert.Equal(t, CircuitOpen, breaker.State())
+		err := breaker.allow()
+		require.Error(t, err)
+		assert.Equal(t, &CircuitOpenError{RetryAfter: time.Minute}, err)
+		assert.Equal(t, []CircuitState{CircuitOpen}, changes)
+	})
+
+	t.Run("fail half-open probe", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		assert.Equal(t, CircuitHalfOpen, breaker.State())
+
+		require.NoError(t, breaker.allow())
+		assert.True(t, isCircuitOpen(breaker.allow()))
+		breaker.done(failed, nil)
+
+		assert.Equal(t, CircuitOpen, breaker.State())
+		assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen}, changes)
+	})
+
+	t.Run("success half-open probe", func(t *testing.T) {
+		now = now.Add(time.Minute)
+
+		require.NoError(t, breaker.allow())
+		breaker.done(succeeded, nil)
+
+		assert.Equal(t, CircuitClosed, breaker.State())
+		assert.Equal(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+	})
+}
+
+func TestClient_circuitBreaker(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	url := "/breaker-test"
+	var requests int
+	httpmock.RegisterResponder("GET", url, func(r *http.Request) (*http.Response, error) {
+		requests++
+		return httpmock.NewStringResponse(http.StatusInternalServerError, testProblemJSON), nil
+	})
+
+	client := &Client{
+		httpClient: http.DefaultClient,
+		breaker:    newCircuitBreaker(&CircuitBreakerOptions{FailureThreshold: 3}, discardLogger)}
+	assert.Equal(t, CircuitClosed, client.CircuitState())
+
+	err := client.httpGET(context.Background(), &backoff.ZeroBackOff{}, url, &map[string]string{}, "error message")
+
+	require.Error(t, err)
+	assert.Regexp(t, "error message: circuit breaker is open", err)
+	assert.True(t, isCircuitOpen(err))
+	assert.Equal(t, 3, requests)
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+}
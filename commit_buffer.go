@@ -0,0 +1,197 @@
+package nakadi
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// closeCommitTimeout limits the time spent on committing buffered cursors when a stream is closed.
+	closeCommitTimeout = 10 * time.Second
+	// defaultSyncCommitInterval is the interval of a synchronous buffer without interval. It bounds the
+	// time a caller waits for the commit if the threshold is not reached.
+	defaultSyncCommitInterval = time.Second
+)
+
+// commitBuffer accumulates the latest cursor of each partition and commits the buffered cursors with a
+// single request per stream. The buffer is flushed once per interval or as soon as a number of cursors
+// was added. Callers of a synchronous buffer wait until their cursor was committed with the next flush.
+// Cursors added while a flush is in progress are committed with the next flush.
+type commitBuffer struct {
+	sync.Mutex
+	commit    func(context.Context, []Cursor) ([]CommitResult, error)
+	onCommit  func(cursors, outdated []Cursor, err error)
+	interval  time.Duration
+	threshold uint
+	async     bool
+	pending   map[StreamPartition]*pendingCommit
+	count     uint
+	closed    bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeCtx  context.Context
+	flushCh   chan struct{}
+	closeCh   chan struct{}
+	done      chan struct{}
+}
+
+// pendingCommit is a buffered cursor along with the channels of all callers waiting for its commit.
+type pendingCommit struct {
+	cursor  Cursor
+	waiters []chan error
+}
+
+// newCommitBuffer creates a commit buffer and starts the background routine which flushes the buffer.
+func newCommitBuffer(commit func(context.Context, []Cursor) ([]CommitResult, error), interval time.Duration, threshold uint, async bool,
+	onCommit func(cursors, outdated []Cursor, err error)) *commitBuffer {
+	if onCommit == nil {
+		onCommit = func(_, _ []Cursor, _ error) {}
+	}
+	if !async && interval == 0 {
+		interval = defaultSyncCommitInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &commitBuffer{
+		commit:    commit,
+		onCommit:  onCommit,
+		interval:  interval,
+		threshold: threshold,
+		async:     async,
+		pending:   make(map[StreamPartition]*pendingCommit),
+		ctx:       ctx,
+		cancel:    cancel,
+		flushCh:   make(chan struct{}, 1),
+		closeCh:   make(chan struct{}),
+		done:      make(chan struct{})}
+	go b.run()
+	return b
+}
+
+// add buffers a cursor. The cursor replaces a previously buffered cursor of the same partition. Unless
+// the buffer is asynchronous, add blocks until the cursor was committed with the next flush and returns
+// the commit error.
+func (b *commitBuffer) add(cursor Cursor) error {
+	b.Lock()
+	if b.closed {
+		b.Unlock()
+		return ErrStreamClosed
+	}
+
+	partition := StreamPartition{EventType: cursor.EventType, Partition: cursor.Partition}
+	entry, ok := b.pending[partition]
+	if !ok {
+		entry = &pendingCommit{}
+		b.pending[partition] = entry
+	}
+	entry.cursor = cursor
+
+	var waiter chan error
+	if !b.async {
+		waiter = make(chan error, 1)
+		entry.waiters = append(entry.waiters, waiter)
+	}
+
+	b.count++
+	if b.threshold > 0 && b.count >= b.threshold {
+		select {
+		case b.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	b.Unlock()
+
+	if waiter == nil {
+		return nil
+	}
+	return <-waiter
+}
+
+// close stops the background routine after a final flush of the buffer. Once ctx is done, the final flush
+// as well as a flush which is still in progress are canceled.
+func (b *commitBuffer) close(ctx context.Context) {
+	b.Lock()
+	if !b.closed {
+		b.closed = true
+		b.closeCtx = ctx
+		close(b.closeCh)
+	}
+	b.Unlock()
+
+	stop := context.AfterFunc(ctx, b.cancel)
+	defer stop()
+	<-b.done
+	b.cancel()
+}
+
+func (b *commitBuffer) run() {
+	defer close(b.done)
+
+	var tick <-chan time.Time
+	if b.interval > 0 {
+		ticker := time.NewTicker(b.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-b.closeCh:
+			b.flush(b.closeCtx)
+			return
+		case <-b.flushCh:
+			b.flush(b.ctx)
+		case <-tick:
+			b.flush(b.ctx)
+		}
+	}
+}
+
+// flush commits all buffered cursors. Cursors of different streams are committed with separate requests.
+func (b *commitBuffer) flush(ctx context.Context) {
+	b.Lock()
+	pending := b.pending
+	b.pending = make(map[StreamPartition]*pendingCommit)
+	b.count = 0
+	b.Unlock()
+
+	var streamIDs []string
+	streams := make(map[string][]*pendingCommit)
+	for _, entry := range pending {
+		streamID := entry.cursor.NakadiStreamID
+		if _, ok := streams[streamID]; !ok {
+			streamIDs = append(streamIDs, streamID)
+		}
+		streams[streamID] = append(streams[streamID], entry)
+	}
+
+	for _, streamID := range streamIDs {
+		entries := streams[streamID]
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].cursor.EventType != entries[j].cursor.EventType {
+				return entries[i].cursor.EventType < entries[j].cursor.EventType
+			}
+			return entries[i].cursor.Partition < entries[j].cursor.Partition
+		})
+		cursors := make([]Cursor, 0, len(entries))
+		for _, entry := range entries {
+			cursors = append(cursors, entry.cursor)
+		}
+
+		results, err := b.commit(ctx, cursors)
+		var outdated []Cursor
+		for _, result := range results {
+			if result.Result == CommitResultOutdated {
+				outdated = append(outdated, result.Cursor)
+			}
+		}
+		b.onCommit(cursors, outdated, err)
+
+		for _, entry := range entries {
+			for _, waiter := range entry.waiters {
+				waiter <- err
+			}
+		}
+	}
+}
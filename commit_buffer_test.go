@@ -0,0 +1,175 @@
+package nakadi
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type commitRecorder struct {
+	sync.Mutex
+	commits  [][]Cursor
+	outdated []Cursor
+	err      error
+}
+
+func (r *commitRecorder) commit(_ context.Context, cursors []Cursor) ([]CommitResult, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.commits = append(r.commits, cursors)
+	var results []CommitResult
+	for _, cursor := range r.outdated {
+		results = append(results, CommitResult{Cursor: cursor, Result: CommitResultOutdated})
+	}
+	return results, r.err
+}
+
+func (r *commitRecorder) recorded() [][]Cursor {
+	r.Lock()
+	defer r.Unlock()
+	return r.commits
+}
+
+func TestCommitBuffer(t *testing.T) {
+	cursor := func(partition, offset, streamID string) Cursor {
+		return Cursor{EventType: "test", Partition: partition, Offset: offset, NakadiStreamID: streamID}
+	}
+
+	t.Run("commit latest cursors on threshold", func(t *testing.T) {
+		recorder := &commitRecorder{outdated: []Cursor{cursor("1", "1", "stream-a")}}
+		results := make(chan []Cursor, 1)
+		buffer := newCommitBuffer(recorder.commit, 0, 3, true, func(cursors, outdated []Cursor, err error) {
+			assert.NoError(t, err)
+			assert.Equal(t, recorder.outdated, outdated)
+			results <- cursors
+		})
+		defer buffer.close(context.Background())
+
+		require.NoError(t, buffer.add(cursor("0", "1", "stream-a")))
+		require.NoError(t, buffer.add(cursor("1", "1", "stream-a")))
+		require.NoError(t, buffer.add(cursor("0", "2", "stream-a")))
+
+		select {
+		case cursors := <-results:
+			assert.Equal(t, []Cursor{cursor("0", "2", "stream-a"), cursor("1", "1", "stream-a")}, cursors)
+		case <-time.After(time.Second):
+			assert.Fail(t, "cursors were not committed")
+		}
+	})
+
+	t.Run("commit on interval and wait for result", func(t *testing.T) {
+		recorder := &commitRecorder{err: assert.AnError}
+		buffer := newCommitBuffer(recorder.commit, 10*time.Millisecond, 0, false, nil)
+		defer buffer.close(context.Background())
+
+		err := buffer.add(cursor("0", "1", "stream-a"))
+
+		assert.Equal(t, assert.AnError, err)
+		assert.Equal(t, [][]Cursor{{cursor("0", "1", "stream-a")}}, recorder.recorded())
+	})
+
+	t.Run("commit on threshold and wait for result", func(t *testing.T) {
+		recorder := &commitRecorder{}
+		buffer := newCommitBuffer(recorder.commit, time.Hour, 3, false, nil)
+		defer buffer.close(context.Background())
+
+		errCh := make(chan error, 3)
+		for _, partition := range []string{"0", "1", "2"} {
+			go func() { errCh <- buffer.add(cursor(partition, "1", "stream-a")) }()
+		}
+
+		for i := 0; i < 3; i++ {
+			select {
+			case err := <-errCh:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				require.Fail(t, "cursors were not committed")
+			}
+		}
+		assert.Equal(t, [][]Cursor{{cursor("0", "1", "stream-a"), cursor("1", "1", "stream-a"),
+			cursor("2", "1", "stream-a")}}, recorder.recorded())
+	})
+
+	t.Run("wait for interval below threshold", func(t *testing.T) {
+		recorder := &commitRecorder{}
+		buffer := newCommitBuffer(recorder.commit, 50*time.Millisecond, 3, false, nil)
+		defer buffer.close(context.Background())
+
+		start := time.Now()
+		require.NoError(t, buffer.add(cursor("0", "1", "stream-a")))
+		require.NoError(t, buffer.add(cursor("0", "2", "stream-a")))
+
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		assert.Equal(t, [][]Cursor{{cursor("0", "1", "stream-a")}, {cursor("0", "2", "stream-a")}},
+			recorder.recorded())
+	})
+
+	t.Run("default interval in sync mode", func(t *testing.T) {
+		buffer := newCommitBuffer((&commitRecorder{}).commit, 0, 3, false, nil)
+		defer buffer.close(context.Background())
+
+		assert.Equal(t, defaultSyncCommitInterval, buffer.interval)
+	})
+
+	t.Run("commit streams separately on close", func(t *testing.T) {
+		recorder := &commitRecorder{}
+		buffer := newCommitBuffer(recorder.commit, time.Hour, 0, true, nil)
+
+		require.NoError(t, buffer.add(cursor("0", "1", "stream-a")))
+		require.NoError(t, buffer.add(cursor("1", "1", "stream-b")))
+		buffer.close(context.Background())
+
+		assert.ElementsMatch(t, [][]Cursor{{cursor("0", "1", "stream-a")}, {cursor("1", "1", "stream-b")}},
+			recorder.recorded())
+		assert.Equal(t, ErrStreamClosed, buffer.add(cursor("0", "2", "stream-a")))
+	})
+}
+
+func TestStreamAPI_CommitCursor_batch(t *testing.T) {
+	streamAPI, opener, committer := setupMockStream(nil, nil)
+	opener.On("openStream").Return(nil, assert.AnError).Maybe()
+	streamAPI.commits = newCommitBuffer(streamAPI.commitCursors, time.Hour, 0, true, nil)
+
+	cursors := []Cursor{
+		{EventType: "test", Partition: "0", Offset: "2", NakadiStreamID: "stream-id"},
+		{EventType: "test", Partition: "1", Offset: "1", NakadiStreamID: "stream-id"}}
+	committer.On("commitCursors", cursors).Once().Return(nil, nil)
+
+	require.NoError(t, streamAPI.CommitCursor(Cursor{EventType: "test", Partition: "0", Offset: "1", NakadiStreamID: "stream-id"}))
+	require.NoError(t, streamAPI.CommitCursor(cursors[1]))
+	require.NoError(t, streamAPI.CommitCursor(cursors[0]))
+	require.NoError(t, streamAPI.Close())
+
+	committer.AssertExpectations(t)
+	committer.AssertNotCalled(t, "commitCursor")
+}
+
+func TestStreamAPI_Close_commitBuffer(t *testing.T) {
+	stream := &mockStreamer{}
+	streamAPI, opener, committer := setupMockStream(nil, nil)
+	streamAPI.commits = newCommitBuffer(streamAPI.commitCursors, time.Hour, 0, true, nil)
+
+	cursor := Cursor{EventType: "test", Partition: "0", Offset: "1", NakadiStreamID: "stream-id"}
+	opener.On("openStream").Once().Return(stream, nil)
+	opener.On("openStream").Return(nil, assert.AnError).Maybe()
+	stream.On("nextEvents").Once().Return(cursor, []byte(`[{}]`), nil)
+	stream.On("nextEvents").Return(Cursor{}, []byte{}, nil)
+	stream.On("closeStream").Return(nil)
+	committer.On("commitCursors", []Cursor{cursor}).Once().Return(nil, nil).Run(func(mock.Arguments) {
+		assert.NoError(t, streamAPI.ctx.Err())
+		stream.AssertNotCalled(t, "closeStream")
+	})
+
+	next, _, err := streamAPI.NextEvents()
+	require.NoError(t, err)
+	require.NoError(t, streamAPI.CommitCursor(next))
+	require.NoError(t, streamAPI.Close())
+
+	committer.AssertExpectations(t)
+	stream.AssertCalled(t, "closeStream")
+}
@@ -1,6 +1,8 @@
 package nakadi
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -48,6 +50,22 @@ type EventTypeOptions struct {
 	RetentionTime int64 `json:"retention_time"`
 }
 
+// A Timeline describes the storage an event type uses during a certain period of time. When an event
+// type is moved to another storage, a new timeline is created and becomes active.
+type Timeline struct {
+	ID          string     `json:"id"`
+	EventType   string     `json:"event_type"`
+	Order       int        `json:"order"`
+	StorageID   string     `json:"storage_id"`
+	Topic       string     `json:"topic"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SwitchedAt  *time.Time `json:"switched_at,omitempty"`
+	CleanedUpAt *time.Time `json:"cleaned_up_at,omitempty"`
+	// LatestPosition holds the latest position of each partition of a timeline that is no longer active.
+	// Its format depends on the storage, e.g. for Kafka it is an object with a list of numeric offsets.
+	LatestPosition json.RawMessage `json:"latest_position,omitempty"`
+}
+
 // EventOptions is a set of optional parameters used to configure the EventAPI.
 type EventOptions struct {
 	// Whether or not methods of the EventAPI retry when a request fails. If
@@ -64,6 +82,9 @@ type EventOptions struct {
 	// Once this value was reached the exponential backoff is halted and the request will
 	// fail with an error.
 	MaxElapsedTime time.Duration
+	// RetryPolicy configures retries in more detail. If set, the policy takes precedence over Retry,
+	// InitialRetryInterval, MaxRetryInterval and MaxElapsedTime.
+	RetryPolicy *RetryPolicy
 }
 
 func (o *EventOptions) withDefaults() *EventOptions {
@@ -80,6 +101,9 @@ func (o *EventOptions) withDefaults() *EventOptions {
 	if copyOptions.MaxElapsedTime == 0 {
 		copyOptions.MaxElapsedTime = defaultMaxElapsedTime
 	}
+	if copyOptions.RetryPolicy != nil {
+		copyOptions.RetryPolicy = copyOptions.RetryPolicy.withDefaults()
+	}
 	return &copyOptions
 }
 
@@ -95,7 +119,8 @@ func NewEventAPI(client *Client, options *EventOptions) *EventAPI {
 			Retry:                options.Retry,
 			InitialRetryInterval: options.InitialRetryInterval,
 			MaxRetryInterval:     options.MaxRetryInterval,
-			MaxElapsedTime:       options.MaxElapsedTime}}
+			MaxElapsedTime:       options.MaxElapsedTime,
+			Policy:               options.RetryPolicy}}
 }
 
 // EventAPI is a sub API that allows to inspect and manage event types on a Nakadi instance.
@@ -106,8 +131,14 @@ type EventAPI struct {
 
 // List returns all registered event types.
 func (e *EventAPI) List() ([]*EventType, error) {
+	return e.ListContext(context.Background())
+}
+
+// ListContext works like List, but uses the given context for all requests. A flow ID carried by the
+// context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) ListContext(ctx context.Context) ([]*EventType, error) {
 	eventTypes := []*EventType{}
-	err := e.client.httpGET(e.backOffConf.create(), e.eventBaseURL(), &eventTypes, "unable to request event types")
+	err := e.client.httpGET(ctx, e.backOffConf.create(), e.eventBaseURL(), &eventTypes, "unable to request event types")
 	if err != nil {
 		return nil, err
 	}
@@ -116,8 +147,14 @@ func (e *EventAPI) List() ([]*EventType, error) {
 
 // Get returns an event type based on its name.
 func (e *EventAPI) Get(name string) (*EventType, error) {
+	return e.GetContext(context.Background(), name)
+}
+
+// GetContext works like Get, but uses the given context for all requests. A flow ID carried by the context
+// is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) GetContext(ctx context.Context, name string) (*EventType, error) {
 	eventType := &EventType{}
-	err := e.client.httpGET(e.backOffConf.create(), e.eventURL(name), eventType, "unable to request event types")
+	err := e.client.httpGET(ctx, e.backOffConf.create(), e.eventURL(name), eventType, "unable to request event types")
 	if err != nil {
 		return nil, err
 	}
@@ -126,9 +163,15 @@ func (e *EventAPI) Get(name string) (*EventType, error) {
 
 // Create saves a new event type.
 func (e *EventAPI) Create(eventType *EventType) error {
+	return e.CreateContext(context.Background(), eventType)
+}
+
+// CreateContext works like Create, but uses the given context for all requests. A flow ID carried by the
+// context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) CreateContext(ctx context.Context, eventType *EventType) error {
 	const errMsg = "unable to create event type"
 
-	response, err := e.client.httpPOST(e.backOffConf.create(), e.eventBaseURL(), eventType, errMsg)
+	response, err := e.client.httpPOST(ctx, e.backOffConf.create(), e.eventBaseURL(), eventType, errMsg)
 	if err != nil {
 		return err
 	}
@@ -139,7 +182,7 @@ func (e *EventAPI) Create(eventType *EventType) error {
 		if err != nil {
 			return errors.Wrapf(err, "%s: unable to read response body", errMsg)
 		}
-		return decodeResponseToError(buffer, errMsg)
+		return withFlowID(decodeResponseToError(buffer, errMsg), response.Request)
 	}
 
 	return nil
@@ -147,9 +190,15 @@ func (e *EventAPI) Create(eventType *EventType) error {
 
 // Update updates an existing event type.
 func (e *EventAPI) Update(eventType *EventType) error {
+	return e.UpdateContext(context.Background(), eventType)
+}
+
+// UpdateContext works like Update, but uses the given context for all requests. A flow ID carried by the
+// context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) UpdateContext(ctx context.Context, eventType *EventType) error {
 	const errMsg = "unable to update event type"
 
-	response, err := e.client.httpPUT(e.backOffConf.create(), e.eventURL(eventType.Name), eventType, errMsg)
+	response, err := e.client.httpPUT(ctx, e.backOffConf.create(), e.eventURL(eventType.Name), eventType, errMsg)
 	if err != nil {
 		return err
 	}
@@ -160,7 +209,7 @@ func (e *EventAPI) Update(eventType *EventType) error {
 		if err != nil {
 			return errors.Wrapf(err, "%s: unable to read response body", errMsg)
 		}
-		return decodeResponseToError(buffer, "unable to update event type")
+		return withFlowID(decodeResponseToError(buffer, "unable to update event type"), response.Request)
 	}
 
 	return nil
@@ -168,13 +217,176 @@ func (e *EventAPI) Update(eventType *EventType) error {
 
 // Delete removes an event type.
 func (e *EventAPI) Delete(name string) error {
-	return e.client.httpDELETE(e.backOffConf.create(), e.eventURL(name), "unable to delete event type")
+	return e.DeleteContext(context.Background(), name)
+}
+
+// DeleteContext works like Delete, but uses the given context for all requests. A flow ID carried by the
+// context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) DeleteContext(ctx context.Context, name string) error {
+	return e.client.httpDELETE(ctx, e.backOffConf.create(), e.eventURL(name), "unable to delete event type")
+}
+
+// ListTimelines returns all timelines of the event type with the given name.
+func (e *EventAPI) ListTimelines(name string) ([]*Timeline, error) {
+	return e.ListTimelinesContext(context.Background(), name)
+}
+
+// ListTimelinesContext works like ListTimelines, but uses the given context for all requests. A flow ID
+// carried by the context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) ListTimelinesContext(ctx context.Context, name string) ([]*Timeline, error) {
+	timelines := []*Timeline{}
+	err := e.client.httpGET(ctx, e.backOffConf.create(), e.timelinesURL(name), &timelines, "unable to request timelines")
+	if err != nil {
+		return nil, err
+	}
+	return timelines, nil
+}
+
+// CreateTimeline creates a new timeline for the event type with the given name. Once the timeline was
+// created, new events are written to the storage identified by storageID.
+func (e *EventAPI) CreateTimeline(name, storageID string) error {
+	return e.CreateTimelineContext(context.Background(), name, storageID)
+}
+
+// CreateTimelineContext works like CreateTimeline, but uses the given context for all requests. A flow ID
+// carried by the context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) CreateTimelineContext(ctx context.Context, name, storageID string) error {
+	const errMsg = "unable to create timeline"
+
+	body := struct {
+		StorageID string `json:"storage_id"`
+	}{StorageID: storageID}
+
+	response, err := e.client.httpPOST(ctx, e.backOffConf.create(), e.timelinesURL(name), body, errMsg)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		buffer, err := io.ReadAll(response.Body)
+		if err != nil {
+			return errors.Wrapf(err, "%s: unable to read response body", errMsg)
+		}
+		return withFlowID(decodeResponseToError(buffer, errMsg), response.Request)
+	}
+
+	return nil
+}
+
+// EventTypeDependencies describes the subscriptions that consume events from a certain event type.
+type EventTypeDependencies struct {
+	EventType     string
+	Subscriptions []*SubscriptionDependency
+}
+
+// SubscriptionDependency describes a single subscription that depends on an event type, along with
+// the number of events of this event type the subscription has not consumed yet.
+type SubscriptionDependency struct {
+	Subscription     *Subscription
+	UnconsumedEvents int
+}
+
+// HasDependencies returns true if at least one subscription consumes events from the event type.
+func (d *EventTypeDependencies) HasDependencies() bool {
+	return d != nil && len(d.Subscriptions) > 0
+}
+
+// UnconsumedEvents returns the total number of unconsumed events over all dependent subscriptions.
+func (d *EventTypeDependencies) UnconsumedEvents() int {
+	if d == nil {
+		return 0
+	}
+	var total int
+	for _, sub := range d.Subscriptions {
+		total += sub.UnconsumedEvents
+	}
+	return total
+}
+
+// EventTypeInUseError is returned by SafeDelete if an event type can not be deleted, because there are
+// subscriptions depending on it.
+type EventTypeInUseError struct {
+	Dependencies *EventTypeDependencies
+}
+
+// Error implements the error interface for EventTypeInUseError.
+func (err *EventTypeInUseError) Error() string {
+	return fmt.Sprintf("event type %s is used by %d subscriptions with %d unconsumed events",
+		err.Dependencies.EventType, len(err.Dependencies.Subscriptions), err.Dependencies.UnconsumedEvents())
+}
+
+// Dependencies returns all subscriptions that consume events from the event type with the given name
+// together with the number of events each of the subscriptions has not consumed yet.
+func (e *EventAPI) Dependencies(name string) (*EventTypeDependencies, error) {
+	return e.DependenciesContext(context.Background(), name)
+}
+
+// DependenciesContext works like Dependencies, but uses the given context for all requests. A flow ID
+// carried by the context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) DependenciesContext(ctx context.Context, name string) (*EventTypeDependencies, error) {
+	ctx = ensureFlowID(ctx)
+	subAPI := &SubscriptionAPI{client: e.client, backOffConf: e.backOffConf}
+
+	subscriptions, err := subAPI.ListForEventTypeContext(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to inspect event type dependencies")
+	}
+
+	dependencies := &EventTypeDependencies{EventType: name}
+	for _, sub := range subscriptions {
+		stats, err := subAPI.GetStatsContext(ctx, sub.ID)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to inspect event type dependencies")
+		}
+
+		dependency := &SubscriptionDependency{Subscription: sub}
+		for _, stat := range stats {
+			if stat.EventType != name {
+				continue
+			}
+			for _, partition := range stat.Partitions {
+				dependency.UnconsumedEvents += partition.UnconsumedEvents
+			}
+		}
+		dependencies.Subscriptions = append(dependencies.Subscriptions, dependency)
+	}
+
+	return dependencies, nil
+}
+
+// SafeDelete removes an event type only if no subscriptions depend on it. If there are dependent
+// subscriptions, SafeDelete refuses to delete the event type and returns an *EventTypeInUseError
+// unless force is true. In any case the inspected dependencies are returned, so that callers can
+// report which subscriptions were (or would have been) orphaned.
+func (e *EventAPI) SafeDelete(name string, force bool) (*EventTypeDependencies, error) {
+	return e.SafeDeleteContext(context.Background(), name, force)
+}
+
+// SafeDeleteContext works like SafeDelete, but uses the given context for all requests. A flow ID carried
+// by the context is sent along with the requests, see ContextWithFlowID.
+func (e *EventAPI) SafeDeleteContext(ctx context.Context, name string, force bool) (*EventTypeDependencies, error) {
+	ctx = ensureFlowID(ctx)
+	dependencies, err := e.DependenciesContext(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dependencies.HasDependencies() && !force {
+		return dependencies, &EventTypeInUseError{Dependencies: dependencies}
+	}
+
+	return dependencies, e.DeleteContext(ctx, name)
 }
 
 func (e *EventAPI) eventURL(name string) string {
 	return fmt.Sprintf("%s/event-types/%s", e.client.nakadiURL, name)
 }
 
+func (e *EventAPI) timelinesURL(name string) string {
+	return fmt.Sprintf("%s/event-types/%s/timelines", e.client.nakadiURL, name)
+}
+
 func (e *EventAPI) eventBaseURL() string {
 	return fmt.Sprintf("%s/event-types", e.client.nakadiURL)
 }
@@ -282,6 +282,205 @@ func TestEventAPI_Delete(t *testing.T) {
 	})
 }
 
+func TestTimeline_Marshal(t *testing.T) {
+	timelines := []*Timeline{}
+	expected := helperLoadTestData(t, "timelines.json", &timelines)
+
+	serialized, err := json.Marshal(timelines)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(serialized))
+
+	var position struct {
+		Offsets []int64 `json:"offsets"`
+	}
+	require.NoError(t, json.Unmarshal(timelines[0].LatestPosition, &position))
+	assert.Equal(t, []int64{42, 17}, position.Offsets)
+	assert.Nil(t, timelines[1].LatestPosition)
+}
+
+func TestEventAPI_ListTimelines(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	name := "test-event.data"
+	expected := []*Timeline{}
+	serialized := helperLoadTestData(t, "timelines.json", &expected)
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	api := NewEventAPI(client, nil)
+	url := fmt.Sprintf("%s/event-types/%s/timelines", defaultNakadiURL, name)
+
+	t.Run("fail connection error", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", url, httpmock.NewErrorResponder(assert.AnError))
+
+		_, err := api.ListTimelines(name)
+		require.Error(t, err)
+		assert.Regexp(t, assert.AnError, err)
+	})
+
+	t.Run("fail with problem", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusForbidden, testProblemJSON))
+
+		_, err := api.ListTimelines(name)
+		require.Error(t, err)
+		assert.Regexp(t, "unable to request timelines: some problem detail", err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", url, httpmock.NewBytesResponder(http.StatusOK, serialized))
+
+		timelines, err := api.ListTimelines(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, timelines)
+	})
+}
+
+func TestEventAPI_CreateTimeline(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	name := "test-event.data"
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	api := NewEventAPI(client, nil)
+	url := fmt.Sprintf("%s/event-types/%s/timelines", defaultNakadiURL, name)
+
+	t.Run("fail connection error", func(t *testing.T) {
+		httpmock.RegisterResponder("POST", url, httpmock.NewErrorResponder(assert.AnError))
+
+		err := api.CreateTimeline(name, "secondary")
+		require.Error(t, err)
+		assert.Regexp(t, assert.AnError, err)
+	})
+
+	t.Run("fail with problem", func(t *testing.T) {
+		httpmock.RegisterResponder("POST", url, httpmock.NewStringResponder(http.StatusUnprocessableEntity, testProblemJSON))
+
+		err := api.CreateTimeline(name, "secondary")
+		require.Error(t, err)
+		assert.Regexp(t, "unable to create timeline: some problem detail", err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		httpmock.RegisterResponder("POST", url, httpmock.Responder(func(r *http.Request) (*http.Response, error) {
+			body := map[string]string{}
+			err := json.NewDecoder(r.Body).Decode(&body)
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"storage_id": "secondary"}, body)
+			return httpmock.NewStringResponse(http.StatusCreated, ""), nil
+		}))
+
+		err := api.CreateTimeline(name, "secondary")
+		require.NoError(t, err)
+	})
+}
+
+func TestEventAPI_Dependencies(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	name := "test-event.data"
+	subscription := &Subscription{}
+	helperLoadTestData(t, "subscription.json", subscription)
+	stats := helperLoadTestData(t, "subscription-stats.json", nil)
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	api := NewEventAPI(client, nil)
+	listURL := fmt.Sprintf("%s/subscriptions?event_type=%s", defaultNakadiURL, name)
+	statsURL := fmt.Sprintf("%s/subscriptions/%s/stats", defaultNakadiURL, subscription.ID)
+
+	t.Run("fail list subscriptions", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", listURL, httpmock.NewErrorResponder(assert.AnError))
+
+		_, err := api.Dependencies(name)
+		require.Error(t, err)
+		assert.Regexp(t, "unable to inspect event type dependencies", err)
+	})
+
+	t.Run("fail get stats", func(t *testing.T) {
+		responder, err := httpmock.NewJsonResponder(http.StatusOK, map[string]interface{}{"items": []*Subscription{subscription}})
+		require.NoError(t, err)
+		httpmock.RegisterResponder("GET", listURL, responder)
+		httpmock.RegisterResponder("GET", statsURL, httpmock.NewErrorResponder(assert.AnError))
+
+		_, err = api.Dependencies(name)
+		require.Error(t, err)
+		assert.Regexp(t, assert.AnError, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		responder, err := httpmock.NewJsonResponder(http.StatusOK, map[string]interface{}{"items": []*Subscription{subscription}})
+		require.NoError(t, err)
+		httpmock.RegisterResponder("GET", listURL, responder)
+		httpmock.RegisterResponder("GET", statsURL, httpmock.NewBytesResponder(http.StatusOK, stats))
+
+		dependencies, err := api.Dependencies(name)
+		require.NoError(t, err)
+		assert.True(t, dependencies.HasDependencies())
+		require.Len(t, dependencies.Subscriptions, 1)
+		assert.Equal(t, subscription, dependencies.Subscriptions[0].Subscription)
+		assert.Equal(t, 53454, dependencies.Subscriptions[0].UnconsumedEvents)
+		assert.Equal(t, 53454, dependencies.UnconsumedEvents())
+	})
+}
+
+func TestEventAPI_SafeDelete(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	name := "test-event.data"
+	subscription := &Subscription{}
+	helperLoadTestData(t, "subscription.json", subscription)
+	stats := helperLoadTestData(t, "subscription-stats.json", nil)
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	api := NewEventAPI(client, nil)
+	listURL := fmt.Sprintf("%s/subscriptions?event_type=%s", defaultNakadiURL, name)
+	statsURL := fmt.Sprintf("%s/subscriptions/%s/stats", defaultNakadiURL, subscription.ID)
+	url := fmt.Sprintf("%s/event-types/%s", defaultNakadiURL, name)
+
+	t.Run("success without dependencies", func(t *testing.T) {
+		httpmock.Reset()
+		httpmock.RegisterResponder("GET", listURL, httpmock.NewStringResponder(http.StatusOK, `{"items":[]}`))
+		httpmock.RegisterResponder("DELETE", url, httpmock.NewStringResponder(http.StatusNoContent, ""))
+
+		dependencies, err := api.SafeDelete(name, false)
+		require.NoError(t, err)
+		assert.False(t, dependencies.HasDependencies())
+		assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE "+url])
+	})
+
+	t.Run("fail with dependencies", func(t *testing.T) {
+		httpmock.Reset()
+		responder, err := httpmock.NewJsonResponder(http.StatusOK, map[string]interface{}{"items": []*Subscription{subscription}})
+		require.NoError(t, err)
+		httpmock.RegisterResponder("GET", listURL, responder)
+		httpmock.RegisterResponder("GET", statsURL, httpmock.NewBytesResponder(http.StatusOK, stats))
+		httpmock.RegisterResponder("DELETE", url, httpmock.NewStringResponder(http.StatusNoContent, ""))
+
+		dependencies, err := api.SafeDelete(name, false)
+		require.Error(t, err)
+		require.IsType(t, &EventTypeInUseError{}, err)
+		assert.Regexp(t, "used by 1 subscriptions with 53454 unconsumed events", err)
+		assert.True(t, dependencies.HasDependencies())
+		assert.Equal(t, 0, httpmock.GetCallCountInfo()["DELETE "+url])
+	})
+
+	t.Run("success forced", func(t *testing.T) {
+		httpmock.Reset()
+		responder, err := httpmock.NewJsonResponder(http.StatusOK, map[string]interface{}{"items": []*Subscription{subscription}})
+		require.NoError(t, err)
+		httpmock.RegisterResponder("GET", listURL, responder)
+		httpmock.RegisterResponder("GET", statsURL, httpmock.NewBytesResponder(http.StatusOK, stats))
+		httpmock.RegisterResponder("DELETE", url, httpmock.NewStringResponder(http.StatusNoContent, ""))
+
+		dependencies, err := api.SafeDelete(name, true)
+		require.NoError(t, err)
+		assert.True(t, dependencies.HasDependencies())
+		assert.Equal(t, 1, httpmock.GetCallCountInfo()["DELETE "+url])
+	})
+}
+
 func TestEventOptions_withDefaults(t *testing.T) {
 	tests := []struct {
 		Options  *EventOptions
@@ -0,0 +1,212 @@
+package nakadi
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultFailbackInterval = time.Minute
+
+// newEndpoints creates the endpoints of a client. If there are no failover URLs, newEndpoints returns nil,
+// which is valid and means that all requests are sent to the primary URL.
+func newEndpoints(primary string, failover []string, failbackInterval time.Duration, onFailover func(string, string), logger *slog.Logger) *endpoints {
+	if len(failover) == 0 {
+		return nil
+	}
+	if onFailover == nil {
+		onFailover = func(_, _ string) {}
+	}
+
+	urls := make([]string, 0, len(failover)+1)
+	for _, u := range append([]string{primary}, failover...) {
+		urls = append(urls, strings.TrimSuffix(u, "/"))
+	}
+
+	return &endpoints{
+		urls:             urls,
+		failbackInterval: failbackInterval,
+		onFailover:       onFailover,
+		logger:           logger,
+		now:              time.Now}
+}
+
+// endpoints keeps track of the active base URL of a client with failover URLs. The first URL is the
+// primary URL. A nil *endpoints is valid and always uses the primary URL.
+type endpoints struct {
+	sync.Mutex
+	urls             []string
+	failbackInterval time.Duration
+	onFailover       func(from, to string)
+	logger           *slog.Logger
+	now              func() time.Time
+
+	breakers   []*circuitBreaker
+	active     int
+	switchedAt time.Time
+	probing    bool
+}
+
+// breaker returns the circuit breaker of the failover URL with the given index. The primary URL uses the
+// circuit breaker of the client, which is passed as primary.
+func (e *endpoints) breaker(index int, primary *circuitBreaker) *circuitBreaker {
+	if index == 0 {
+		return primary
+	}
+	if index > len(e.breakers) {
+		return nil
+	}
+	return e.breakers[index-1]
+}
+
+// activeURL returns the base URL requests are currently sent to.
+func (e *endpoints) activeURL() string {
+	e.Lock()
+	defer e.Unlock()
+	return e.urls[e.active]
+}
+
+// next returns the index and base URL a request should be sent to. If the failback interval has passed
+// since the last failover and no other probe is in progress, the primary URL is returned and probe is
+// true. In this case the outcome of the request must be reported via probed.
+func (e *endpoints) next() (index int, base string, probe bool) {
+	e.Lock()
+	defer e.Unlock()
+	if e.active != 0 && !e.probing && !e.now().Before(e.switchedAt.Add(e.failbackInterval)) {
+		e.probing = true
+		return 0, e.urls[0], true
+	}
+	return e.active, e.urls[e.active], false
+}
+
+// probed records the outcome of a probe request to the primary URL. If the primary URL is healthy it
+// becomes active again, otherwise the next probe is sent once the failback interval has passed again.
+func (e *endpoints) probed(healthy bool) {
+	e.Lock()
+	e.probing = false
+	e.switchedAt = e.now()
+	from := e.urls[e.active]
+	if !healthy || e.active == 0 {
+		e.Unlock()
+		return
+	}
+	e.active = 0
+	to := e.urls[e.active]
+	e.Unlock()
+
+	e.logger.Info("failing back to primary Nakadi URL", "from", from, "to", to)
+	e.onFailover(from, to)
+}
+
+// failed marks the URL with the given index as unhealthy and activates the next URL. Nothing happens
+// if the URL is not active anymore, e.g. because a concurrent request already failed over.
+func (e *endpoints) failed(index int, cause error) {
+	e.Lock()
+	if index != e.active {
+		e.Unlock()
+		return
+	}
+	from := e.urls[e.active]
+	e.active = (e.active + 1) % len(e.urls)
+	e.switchedAt = e.now()
+	to := e.urls[e.active]
+	e.Unlock()
+
+	e.logger.Warn("failing over to next Nakadi URL", "from", from, "to", to, "error", cause)
+	e.onFailover(from, to)
+}
+
+// ActiveURL returns the base URL to which management and publish requests are currently sent. Without
+// failover URLs this is always the URL passed to New.
+func (c *Client) ActiveURL() string {
+	if c.endpoints == nil {
+		return c.nakadiURL
+	}
+	return c.endpoints.activeURL()
+}
+
+// doFailover sends a request to the active URL. If the request fails due to a connection error or a status
+// code of 500 or above, it is sent to the next URL until each URL was tried once. Once the failback interval
+// has passed after a failover, a request is sent to the primary URL as probe. Only if the probe succeeds,
+// the primary URL becomes active again, otherwise the request is sent to the active URL. Requests that do
+// not target the primary URL are sent as they are.
+func (c *Client) doFailover(request *http.Request) (*http.Response, error) {
+	if c.endpoints == nil {
+		return c.do(c.httpClient, request)
+	}
+	path, ok := strings.CutPrefix(request.URL.String(), c.endpoints.urls[0])
+	if !ok || (path != "" && path[0] != '/' && path[0] != '?') {
+		return c.do(c.httpClient, request)
+	}
+
+	var response *http.Response
+	var err error
+	for tried := 0; tried < len(c.endpoints.urls); {
+		index, base, probe := c.endpoints.next()
+		if !probe {
+			tried++
+		}
+
+		target, cloneErr := cloneRequestURL(request, base+path)
+		if cloneErr != nil {
+			if probe {
+				c.endpoints.probed(false)
+			}
+			return nil, cloneErr
+		}
+
+		response, err = c.doBreaker(c.endpoints.breaker(index, c.breaker), c.httpClient, target)
+		healthy := err == nil && response.StatusCode < 500
+		if probe {
+			c.endpoints.probed(healthy)
+		}
+		if healthy {
+			return response, nil
+		}
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return response, err
+		}
+
+		cause := err
+		if cause == nil {
+			cause = errors.Errorf("status code %d", response.StatusCode)
+		}
+		if probe {
+			c.log().Debug("primary Nakadi URL is still unhealthy", "error", cause)
+		} else {
+			c.endpoints.failed(index, cause)
+		}
+
+		if (probe || tried < len(c.endpoints.urls)) && response != nil {
+			_, _ = io.Copy(io.Discard, response.Body)
+			_ = response.Body.Close()
+		}
+	}
+
+	return response, err
+}
+
+// cloneRequestURL creates a copy of a request with a different URL.
+func cloneRequestURL(request *http.Request, rawURL string) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse failover URL")
+	}
+
+	clone := request.Clone(request.Context())
+	clone.URL = u
+	clone.Host = u.Host
+	if request.GetBody != nil {
+		if clone.Body, err = request.GetBody(); err != nil {
+			return nil, errors.Wrap(err, "unable to copy request body")
+		}
+	}
+	return clone, nil
+}
@@ -0,0 +1,155 @@
+package nakadi
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ActiveURL(t *testing.T) {
+	t.Run("without failover", func(t *testing.T) {
+		client := New(defaultNakadiURL, nil)
+
+		assert.Nil(t, client.endpoints)
+		assert.Equal(t, defaultNakadiURL, client.ActiveURL())
+	})
+
+	t.Run("with failover", func(t *testing.T) {
+		client := New(defaultNakadiURL, &ClientOptions{FailoverURLs: []string{"https://nakadi.secondary.example.com/"}})
+
+		require.NotNil(t, client.endpoints)
+		assert.Equal(t, []string{defaultNakadiURL, "https://nakadi.secondary.example.com"}, client.endpoints.urls)
+		assert.Equal(t, defaultFailbackInterval, client.endpoints.failbackInterval)
+		assert.Equal(t, defaultNakadiURL, client.ActiveURL())
+	})
+}
+
+func TestClient_doFailover(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	primary := "https://nakadi.primary.example.com"
+	secondary := "https://nakadi.secondary.example.com"
+	now := time.Date(2017, 8, 12, 7, 0, 0, 0, time.UTC)
+
+	var changes []string
+	client := &Client{
+		nakadiURL:  primary,
+		httpClient: http.DefaultClient,
+		endpoints: newEndpoints(primary, []string{secondary}, time.Minute,
+			func(_, to string) { changes = append(changes, to) }, discardLogger)}
+	client.endpoints.now = func() time.Time { return now }
+
+	primaryStatus := http.StatusServiceUnavailable
+	var bodies []string
+	httpmock.RegisterResponder("POST", primary+"/event-types/test/events", func(r *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, "primary:"+string(body))
+		return httpmock.NewStringResponse(primaryStatus, testProblemJSON), nil
+	})
+	httpmock.RegisterResponder("POST", secondary+"/event-types/test/events", func(r *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, "secondary:"+string(body))
+		assert.Equal(t, "nakadi.secondary.example.com", r.Host)
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+	publish := func() (*http.Response, error) {
+		return client.httpPOST(context.Background(), &backoff.StopBackOff{}, primary+"/event-types/test/events", []string{"event"}, "error message")
+	}
+
+	t.Run("success fail over", func(t *testing.T) {
+		response, err := publish()
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, []string{`primary:["event"]`, `secondary:["event"]`}, bodies)
+		assert.Equal(t, secondary, client.ActiveURL())
+		assert.Equal(t, []string{secondary}, changes)
+	})
+
+	t.Run("success stay on secondary", func(t *testing.T) {
+		bodies = nil
+		now = now.Add(30 * time.Second)
+
+		_, err := publish()
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{`secondary:["event"]`}, bodies)
+	})
+
+	t.Run("success stay on secondary if primary is unhealthy", func(t *testing.T) {
+		bodies = nil
+		now = now.Add(time.Minute)
+
+		_, err := publish()
+		require.NoError(t, err)
+		_, err = publish()
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{`primary:["event"]`, `secondary:["event"]`, `secondary:["event"]`}, bodies)
+		assert.Equal(t, secondary, client.ActiveURL())
+		assert.Equal(t, []string{secondary}, changes)
+	})
+
+	t.Run("success fail back", func(t *testing.T) {
+		bodies = nil
+		primaryStatus = http.StatusOK
+		now = now.Add(time.Minute)
+		assert.Equal(t, secondary, client.ActiveURL())
+		assert.Equal(t, []string{secondary}, changes)
+
+		_, err := publish()
+
+		require.NoError(t, err)
+		assert.Equal(t, []string{`primary:["event"]`}, bodies)
+		assert.Equal(t, primary, client.ActiveURL())
+		assert.Equal(t, []string{secondary, primary}, changes)
+	})
+
+	t.Run("success no fail over on client errors", func(t *testing.T) {
+		bodies = nil
+		primaryStatus = http.StatusUnprocessableEntity
+
+		response, err := publish()
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+		assert.Equal(t, []string{`primary:["event"]`}, bodies)
+		assert.Equal(t, primary, client.ActiveURL())
+	})
+}
+
+func TestClient_doFailover_circuitBreaker(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	primary := "https://nakadi.primary.example.com"
+	secondary := "https://nakadi.secondary.example.com"
+	client := New(primary, &ClientOptions{
+		FailoverURLs:   []string{secondary},
+		CircuitBreaker: &CircuitBreakerOptions{FailureThreshold: 1},
+		HTTPClient:     http.DefaultClient,
+		Logger:         discardLogger})
+
+	httpmock.RegisterResponder("GET", primary+"/subscriptions", httpmock.NewStringResponder(http.StatusServiceUnavailable, testProblemJSON))
+	httpmock.RegisterResponder("GET", secondary+"/subscriptions", httpmock.NewStringResponder(http.StatusOK, "{}"))
+
+	for i := 0; i < 2; i++ {
+		body := map[string]interface{}{}
+		err := client.httpGET(context.Background(), &backoff.StopBackOff{}, primary+"/subscriptions", &body, "error message")
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, CircuitOpen, client.CircuitState())
+	require.Len(t, client.endpoints.breakers, 1)
+	assert.Equal(t, CircuitClosed, client.endpoints.breakers[0].State())
+	assert.Equal(t, secondary, client.ActiveURL())
+	assert.Equal(t, 1, httpmock.GetCallCountInfo()["GET "+primary+"/subscriptions"])
+}
@@ -0,0 +1,99 @@
+package nakadi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+const flowIDHeader = "X-Flow-Id"
+
+type flowIDKey struct{}
+
+// ContextWithFlowID returns a copy of ctx which carries the given flow ID. All requests sent to Nakadi with
+// this context use the flow ID as X-Flow-Id header, which allows to correlate requests with Nakadi's logs.
+func ContextWithFlowID(ctx context.Context, flowID string) context.Context {
+	return context.WithValue(ctx, flowIDKey{}, flowID)
+}
+
+// FlowIDFromContext returns the flow ID carried by ctx or an empty string if ctx carries no flow ID.
+func FlowIDFromContext(ctx context.Context) string {
+	flowID, _ := ctx.Value(flowIDKey{}).(string)
+	return flowID
+}
+
+// NewFlowID generates a new random flow ID.
+func NewFlowID() string {
+	buffer := make([]byte, 16)
+	_, _ = rand.Read(buffer)
+	return base64.RawURLEncoding.EncodeToString(buffer)
+}
+
+// ensureFlowID returns a context which carries a flow ID. If ctx carries no flow ID, a new one is generated.
+func ensureFlowID(ctx context.Context) context.Context {
+	if FlowIDFromContext(ctx) != "" {
+		return ctx
+	}
+	return ContextWithFlowID(ctx, NewFlowID())
+}
+
+// setFlowID sets the X-Flow-Id header of a request, unless it is already present. The flow ID is taken
+// from the context of the request or generated if the context carries no flow ID.
+func setFlowID(request *http.Request) {
+	if request.Header.Get(flowIDHeader) != "" {
+		return
+	}
+	flowID := FlowIDFromContext(request.Context())
+	if flowID == "" {
+		flowID = NewFlowID()
+	}
+	request.Header.Set(flowIDHeader, flowID)
+}
+
+// FlowIDError is returned for failed requests. It contains the flow ID of the request, which can be used
+// to find the request in Nakadi's logs.
+type FlowIDError struct {
+	FlowID string
+	Err    error
+}
+
+func (e *FlowIDError) Error() string {
+	return fmt.Sprintf("%s (flow id: %s)", e.Err.Error(), e.FlowID)
+}
+
+// Cause returns the underlying error.
+func (e *FlowIDError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *FlowIDError) Unwrap() error {
+	return e.Err
+}
+
+// FlowIDFromError returns the flow ID of the request that caused err or an empty string if err does not
+// carry a flow ID.
+func FlowIDFromError(err error) string {
+	var flowIDErr *FlowIDError
+	if errors.As(err, &flowIDErr) {
+		return flowIDErr.FlowID
+	}
+	return ""
+}
+
+// withFlowID adds the flow ID of a request to an error. If err is nil or already carries a flow ID, err
+// is returned as is.
+func withFlowID(err error, request *http.Request) error {
+	if err == nil || request == nil || FlowIDFromError(err) != "" {
+		return err
+	}
+	flowID := request.Header.Get(flowIDHeader)
+	if flowID == "" {
+		return err
+	}
+	return &FlowIDError{FlowID: flowID, Err: err}
+}
@@ -0,0 +1,98 @@
+package nakadi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextWithFlowID(t *testing.T) {
+	assert.Empty(t, FlowIDFromContext(context.Background()))
+
+	ctx := ContextWithFlowID(context.Background(), "flow-id")
+	assert.Equal(t, "flow-id", FlowIDFromContext(ctx))
+	assert.Equal(t, ctx, ensureFlowID(ctx))
+
+	generated := FlowIDFromContext(ensureFlowID(context.Background()))
+	assert.Len(t, generated, 22)
+	assert.NotEqual(t, generated, NewFlowID())
+}
+
+func TestFlowIDError(t *testing.T) {
+	request, err := http.NewRequest("GET", defaultNakadiURL, nil)
+	require.NoError(t, err)
+
+	assert.Nil(t, withFlowID(nil, request))
+	assert.Equal(t, assert.AnError, withFlowID(assert.AnError, request))
+	assert.Empty(t, FlowIDFromError(assert.AnError))
+
+	request.Header.Set(flowIDHeader, "flow-id")
+	err = withFlowID(errors.Wrap(assert.AnError, "error message"), request)
+
+	assert.EqualError(t, err, "error message: "+assert.AnError.Error()+" (flow id: flow-id)")
+	assert.Equal(t, "flow-id", FlowIDFromError(errors.Wrap(err, "outer")))
+	assert.Equal(t, assert.AnError, errors.Cause(err))
+	assert.Same(t, err, withFlowID(err, request))
+}
+
+func TestFlowID_requests(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	subscriptionAPI := NewSubscriptionAPI(client, &SubscriptionOptions{RetryPolicy: &RetryPolicy{MaxAttempts: 3}})
+	url := defaultNakadiURL + "/subscriptions/some-id"
+
+	var flowIDs []string
+	var status int
+	httpmock.RegisterResponder("GET", url, func(r *http.Request) (*http.Response, error) {
+		flowIDs = append(flowIDs, r.Header.Get(flowIDHeader))
+		return httpmock.NewStringResponse(status, testProblemJSON), nil
+	})
+	httpmock.RegisterResponder("POST", url+"/cursors", func(r *http.Request) (*http.Response, error) {
+		flowIDs = append(flowIDs, r.Header.Get(flowIDHeader))
+		return httpmock.NewStringResponse(http.StatusNoContent, ""), nil
+	})
+
+	t.Run("flow id from context", func(t *testing.T) {
+		flowIDs = nil
+		status = http.StatusNotFound
+
+		_, err := subscriptionAPI.GetContext(ContextWithFlowID(context.Background(), "flow-id"), "some-id")
+
+		require.Error(t, err)
+		assert.Equal(t, []string{"flow-id"}, flowIDs)
+		assert.Regexp(t, `unable to request subscription: .* \(flow id: flow-id\)`, err)
+		assert.Equal(t, "flow-id", FlowIDFromError(err))
+	})
+
+	t.Run("generated flow id is the same for all retries", func(t *testing.T) {
+		flowIDs = nil
+		status = http.StatusServiceUnavailable
+
+		_, err := subscriptionAPI.Get("some-id")
+
+		require.Error(t, err)
+		require.Len(t, flowIDs, 3)
+		assert.NotEmpty(t, flowIDs[0])
+		assert.Equal(t, flowIDs[0], flowIDs[1])
+		assert.Equal(t, flowIDs[0], flowIDs[2])
+		assert.Equal(t, flowIDs[0], FlowIDFromError(err))
+	})
+
+	t.Run("flow id on commit", func(t *testing.T) {
+		flowIDs = nil
+		committer := &simpleCommitter{client: client, subscriptionID: "some-id"}
+
+		err := committer.commitCursor(context.Background(), Cursor{NakadiStreamID: "stream-id"})
+
+		require.NoError(t, err)
+		require.Len(t, flowIDs, 1)
+		assert.NotEmpty(t, flowIDs[0])
+	})
+}
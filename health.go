@@ -0,0 +1,242 @@
+package nakadi
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// StreamState describes the connection state of a stream.
+type StreamState int
+
+// Possible connection states of a stream.
+const (
+	// StreamConnecting means that the stream is being opened.
+	StreamConnecting StreamState = iota
+	// StreamStreaming means that the stream is open and batches are read from it.
+	StreamStreaming
+	// StreamBackingOff means that opening the stream failed and the stream waits before the next attempt.
+	StreamBackingOff
+	// StreamClosed means that the stream was closed.
+	StreamClosed
+	// StreamFailed means that reading the stream failed with an error which can't be resolved by
+	// reconnecting, e.g. a BatchTooLargeError. The stream doesn't reconnect until it is closed.
+	StreamFailed
+)
+
+func (s StreamState) String() string {
+	switch s {
+	case StreamConnecting:
+		return "connecting"
+	case StreamStreaming:
+		return "streaming"
+	case StreamBackingOff:
+		return "backing off"
+	case StreamClosed:
+		return "closed"
+	case StreamFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler for StreamState.
+func (s StreamState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// StreamStatus describes the health of a stream.
+type StreamStatus struct {
+	// State is the current connection state
+	State StreamState `json:"state"`
+	// Since is the time when the stream entered the current state
+	Since time.Time `json:"since"`
+	// StreamID is the ID of the current stream or empty if no batch was read from the current stream yet
+	StreamID string `json:"stream_id,omitempty"`
+	// LastBatch is the time when the last batch with events was read
+	LastBatch time.Time `json:"last_batch"`
+	// LastHeartbeat is the time when the last batch was read, including batches without events
+	LastHeartbeat time.Time `json:"last_heartbeat"`
+	// ConsecutiveFailures is the number of failed attempts to open or read the stream since the last
+	// successful attempt
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// LastError is the last error that occurred when opening or reading the stream
+	LastError error `json:"-"`
+}
+
+// MarshalJSON implements json.Marshaler for StreamStatus.
+func (s StreamStatus) MarshalJSON() ([]byte, error) {
+	type plainStatus StreamStatus
+	encoded := struct {
+		plainStatus
+		LastError string `json:"last_error,omitempty"`
+	}{plainStatus: plainStatus(s)}
+	if s.LastError != nil {
+		encoded.LastError = s.LastError.Error()
+	}
+	return json.Marshal(encoded)
+}
+
+// streamHealth keeps track of the status of a stream.
+type streamHealth struct {
+	sync.Mutex
+	status StreamStatus
+	now    func() time.Time
+}
+
+func newStreamHealth() *streamHealth {
+	h := &streamHealth{now: time.Now}
+	h.status.Since = h.now()
+	return h
+}
+
+func (h *streamHealth) setState(state StreamState) {
+	if h.status.State != state {
+		h.status.State = state
+		h.status.Since = h.now()
+	}
+}
+
+// connecting records that the stream is being opened.
+func (h *streamHealth) connecting() {
+	h.Lock()
+	defer h.Unlock()
+	h.setState(StreamConnecting)
+	h.status.StreamID = ""
+}
+
+// failed records that opening or reading the stream failed.
+func (h *streamHealth) failed(err error, backingOff bool) {
+	h.Lock()
+	defer h.Unlock()
+	if backingOff {
+		h.setState(StreamBackingOff)
+	} else {
+		h.setState(StreamConnecting)
+	}
+	h.status.StreamID = ""
+	h.status.ConsecutiveFailures++
+	h.status.LastError = err
+}
+
+// stopped records that reading the stream failed and the stream doesn't reconnect.
+func (h *streamHealth) stopped(err error) {
+	h.Lock()
+	defer h.Unlock()
+	h.setState(StreamFailed)
+	h.status.StreamID = ""
+	h.status.ConsecutiveFailures++
+	h.status.LastError = err
+}
+
+// opened records that the stream was opened successfully.
+func (h *streamHealth) opened() {
+	h.Lock()
+	defer h.Unlock()
+	h.setState(StreamStreaming)
+	h.status.ConsecutiveFailures = 0
+}
+
+// received records that a batch was read from the stream.
+func (h *streamHealth) received(cursor Cursor, events []byte) {
+	h.Lock()
+	defer h.Unlock()
+	now := h.now()
+	h.status.StreamID = cursor.NakadiStreamID
+	h.status.LastHeartbeat = now
+	if len(events) > 0 {
+		h.status.LastBatch = now
+	}
+}
+
+// closed records that the stream was closed.
+func (h *streamHealth) closed() {
+	h.Lock()
+	defer h.Unlock()
+	h.setState(StreamClosed)
+	h.status.StreamID = ""
+}
+
+func (h *streamHealth) snapshot() StreamStatus {
+	h.Lock()
+	defer h.Unlock()
+	return h.status
+}
+
+// ProcessorStatus describes the health of all streams of a processor.
+type ProcessorStatus struct {
+	// Started is true if the processor was started and not stopped yet
+	Started bool `json:"started"`
+	// Streams contains the status of each stream ordered by stream No
+	Streams []StreamStatus `json:"streams"`
+}
+
+// Ready checks whether the processor is started and all of its streams are streaming.
+func (s ProcessorStatus) Ready() bool {
+	if !s.Started {
+		return false
+	}
+	for _, stream := range s.Streams {
+		if stream.State != StreamStreaming {
+			return false
+		}
+	}
+	return true
+}
+
+// Live checks whether none of the streams of a started processor is stuck. A stream is considered stuck
+// if it was closed, or if it is streaming, but no batch or keep-alive was read within maxSilence. Streams
+// which are connecting or backing off are considered live, since they are still trying to recover.
+func (s ProcessorStatus) Live(maxSilence time.Duration, now time.Time) bool {
+	if !s.Started {
+		return true
+	}
+	for _, stream := range s.Streams {
+		switch stream.State {
+		case StreamClosed:
+			return false
+		case StreamStreaming:
+			last := stream.Since
+			if stream.LastHeartbeat.After(last) {
+				last = stream.LastHeartbeat
+			}
+			if now.Sub(last) > maxSilence {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ReadinessHandler returns an http.Handler which can be used as readiness probe. It responds with
+// 200 OK if the processor is ready, otherwise with 503 Service Unavailable. The body contains the status
+// of the processor encoded as JSON.
+func (p *Processor) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		status := p.Status()
+		writeStatus(w, status, status.Ready())
+	})
+}
+
+// LivenessHandler returns an http.Handler which can be used as liveness probe. It responds with 200 OK
+// if the processor is live, otherwise with 503 Service Unavailable. The body contains the status of the
+// processor encoded as JSON. maxSilence should be greater than the flush timeout of the streams, since
+// Nakadi sends keep-alive batches once per flush timeout.
+func (p *Processor) LivenessHandler(maxSilence time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		status := p.Status()
+		writeStatus(w, status, status.Live(maxSilence, time.Now()))
+	})
+}
+
+func writeStatus(w http.ResponseWriter, status ProcessorStatus, healthy bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
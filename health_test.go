@@ -0,0 +1,183 @@
+package nakadi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamState_String(t *testing.T) {
+	assert.Equal(t, "connecting", StreamConnecting.String())
+	assert.Equal(t, "streaming", StreamStreaming.String())
+	assert.Equal(t, "backing off", StreamBackingOff.String())
+	assert.Equal(t, "closed", StreamClosed.String())
+	assert.Equal(t, "failed", StreamFailed.String())
+	assert.Equal(t, "unknown", StreamState(42).String())
+}
+
+func TestStreamHealth(t *testing.T) {
+	now := time.Date(2017, 8, 12, 7, 0, 0, 0, time.UTC)
+	health := newStreamHealth()
+	health.now = func() time.Time { return now }
+
+	health.connecting()
+	now = now.Add(time.Second)
+	health.failed(assert.AnError, true)
+	status := health.snapshot()
+	assert.Equal(t, StreamBackingOff, status.State)
+	assert.Equal(t, now, status.Since)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+	assert.Equal(t, assert.AnError, status.LastError)
+
+	now = now.Add(time.Second)
+	health.connecting()
+	health.opened()
+	status = health.snapshot()
+	assert.Equal(t, StreamStreaming, status.State)
+	assert.Equal(t, now, status.Since)
+	assert.Equal(t, 0, status.ConsecutiveFailures)
+
+	now = now.Add(time.Second)
+	health.received(Cursor{NakadiStreamID: "stream-id"}, []byte(`[{}]`))
+	now = now.Add(time.Second)
+	health.received(Cursor{NakadiStreamID: "stream-id"}, nil)
+	status = health.snapshot()
+	assert.Equal(t, "stream-id", status.StreamID)
+	assert.Equal(t, now.Add(-time.Second), status.LastBatch)
+	assert.Equal(t, now, status.LastHeartbeat)
+
+	health.failed(assert.AnError, false)
+	status = health.snapshot()
+	assert.Equal(t, StreamConnecting, status.State)
+	assert.Empty(t, status.StreamID)
+	assert.Equal(t, 1, status.ConsecutiveFailures)
+
+	health.closed()
+	assert.Equal(t, StreamClosed, health.snapshot().State)
+}
+
+func TestStreamStatus_MarshalJSON(t *testing.T) {
+	status := StreamStatus{State: StreamBackingOff, StreamID: "stream-id", ConsecutiveFailures: 2, LastError: assert.AnError}
+
+	data, err := json.Marshal(status)
+	require.NoError(t, err)
+
+	var decoded map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "backing off", decoded["state"])
+	assert.Equal(t, "stream-id", decoded["stream_id"])
+	assert.Equal(t, float64(2), decoded["consecutive_failures"])
+	assert.Equal(t, assert.AnError.Error(), decoded["last_error"])
+}
+
+func TestProcessorStatus(t *testing.T) {
+	now := time.Now()
+	streaming := StreamStatus{State: StreamStreaming, Since: now.Add(-time.Hour), LastHeartbeat: now.Add(-time.Second)}
+
+	t.Run("not started", func(t *testing.T) {
+		status := ProcessorStatus{Streams: []StreamStatus{{State: StreamClosed}}}
+		assert.False(t, status.Ready())
+		assert.True(t, status.Live(time.Minute, now))
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		status := ProcessorStatus{Started: true, Streams: []StreamStatus{streaming, streaming}}
+		assert.True(t, status.Ready())
+		assert.True(t, status.Live(time.Minute, now))
+	})
+
+	t.Run("backing off", func(t *testing.T) {
+		status := ProcessorStatus{Started: true, Streams: []StreamStatus{streaming, {State: StreamBackingOff}}}
+		assert.False(t, status.Ready())
+		assert.True(t, status.Live(time.Minute, now))
+	})
+
+	t.Run("silent stream", func(t *testing.T) {
+		silent := streaming
+		silent.LastHeartbeat = now.Add(-2 * time.Minute)
+		status := ProcessorStatus{Started: true, Streams: []StreamStatus{streaming, silent}}
+		assert.True(t, status.Ready())
+		assert.False(t, status.Live(time.Minute, now))
+	})
+
+	t.Run("closed stream", func(t *testing.T) {
+		status := ProcessorStatus{Started: true, Streams: []StreamStatus{{State: StreamClosed}}}
+		assert.False(t, status.Live(time.Minute, now))
+	})
+}
+
+func TestProcessor_healthHandlers(t *testing.T) {
+	processor := &Processor{streamOptions: make([]StreamOptions, 2)}
+	stream := &statusStreamAPI{status: StreamStatus{State: StreamStreaming, Since: time.Now()}}
+
+	get := func(handler http.Handler) (int, map[string]interface{}) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+		return recorder.Code, body
+	}
+
+	code, body := get(processor.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, false, body["started"])
+	code, _ = get(processor.LivenessHandler(time.Minute))
+	assert.Equal(t, http.StatusOK, code)
+
+	processor.setRunning(true)
+	processor.setStream(0, stream)
+	code, body = get(processor.ReadinessHandler())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	require.Len(t, body["streams"], 2)
+
+	processor.setStream(1, stream)
+	code, _ = get(processor.ReadinessHandler())
+	assert.Equal(t, http.StatusOK, code)
+
+	stream.status.Since = time.Now().Add(-time.Hour)
+	code, _ = get(processor.LivenessHandler(time.Minute))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+}
+
+func TestStreamAPI_Status(t *testing.T) {
+	blockCh := make(chan time.Time, 1)
+	stream := &mockStreamer{}
+	streamAPI, opener, _ := setupMockStream(nil, nil)
+
+	opener.On("openStream").Once().Return(nil, assert.AnError)
+	opener.On("openStream").Once().Return(stream, nil)
+	stream.On("nextEvents").Once().Return(Cursor{NakadiStreamID: "stream-id"}, []byte(`[{}]`), nil)
+	stream.On("nextEvents").Return(Cursor{}, nil, assert.AnError).WaitUntil(blockCh)
+	stream.On("closeStream").Return(nil)
+
+	_, _, err := streamAPI.NextEvents()
+	require.NoError(t, err)
+
+	status := streamAPI.Status()
+	assert.Equal(t, StreamStreaming, status.State)
+	assert.Equal(t, "stream-id", status.StreamID)
+	assert.False(t, status.LastBatch.IsZero())
+	assert.Equal(t, 0, status.ConsecutiveFailures)
+	assert.Equal(t, assert.AnError, status.LastError)
+
+	opener.On("openStream").Return(nil, assert.AnError)
+	blockCh <- time.Now()
+	close(blockCh)
+	require.NoError(t, streamAPI.Close())
+	assert.Equal(t, StreamClosed, streamAPI.Status().State)
+}
+
+type statusStreamAPI struct {
+	mockStreamAPI
+	status StreamStatus
+}
+
+func (s *statusStreamAPI) Status() StreamStatus {
+	return s.status
+}
@@ -19,7 +19,7 @@ const (
 )
 
 // newHTTPClient crates a http client which is used for non-streaming requests.
-func newHTTPClient(timeout time.Duration, middleware Middleware) *http.Client {
+func newHTTPClient(timeout time.Duration, transportOptions *TransportOptions, middleware Middleware) *http.Client {
 	t := &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
@@ -30,25 +30,27 @@ func newHTTPClient(timeout time.Duration, middleware Middleware) *http.Client {
 		IdleConnTimeout:     defaultIdleConnTimeout,
 		TLSHandshakeTimeout: timeout,
 	}
+	transportOptions.apply(t)
 	return &http.Client{
 		Timeout:   timeout,
 		Transport: middleware(t)}
 }
 
 // newHTTPStream creates a http client which is used for streaming purposes.
-func newHTTPStream(timeout time.Duration) *http.Client {
-	return &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   timeout,
-				KeepAlive: 2 * nakadiHeartbeatInterval,
-			}).DialContext,
-			MaxIdleConns:        100,
-			IdleConnTimeout:     2 * nakadiHeartbeatInterval,
-			TLSHandshakeTimeout: timeout,
-		},
+func newHTTPStream(timeout time.Duration, transportOptions *TransportOptions, middleware Middleware) *http.Client {
+	t := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   timeout,
+			KeepAlive: 2 * nakadiHeartbeatInterval,
+		}).DialContext,
+		MaxIdleConns:        100,
+		IdleConnTimeout:     2 * nakadiHeartbeatInterval,
+		TLSHandshakeTimeout: timeout,
 	}
+	transportOptions.apply(t)
+	return &http.Client{
+		Transport: middleware(t)}
 }
 
 // problemJSON is used to decode error responses.
@@ -94,10 +96,15 @@ type backOffConfiguration struct {
 	MaxRetryInterval time.Duration
 	// MaxElapsedTime is the maximum time spent on retries.
 	MaxElapsedTime time.Duration
+	// Policy takes precedence over all other fields if set.
+	Policy *RetryPolicy
 }
 
 // create initializes a new backoff from configured parameters.
 func (rc *backOffConfiguration) create() backoff.BackOff {
+	if rc.Policy != nil {
+		return rc.Policy.create()
+	}
 	if !rc.Retry {
 		return &backoff.StopBackOff{}
 	}
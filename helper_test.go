@@ -15,7 +15,7 @@ import (
 
 func TestNewHTTPClient(t *testing.T) {
 	timeout := 20 * time.Second
-	client := newHTTPClient(timeout, func(transport *http.Transport) http.RoundTripper { return transport })
+	client := newHTTPClient(timeout, nil, func(transport *http.Transport) http.RoundTripper { return transport })
 
 	require.NotNil(t, client)
 	assert.Equal(t, timeout, client.Timeout)
@@ -23,10 +23,15 @@ func TestNewHTTPClient(t *testing.T) {
 
 func TestNewHTTPStream(t *testing.T) {
 	timeout := 20 * time.Second
-	client := newHTTPStream(timeout)
+	var applied bool
+	client := newHTTPStream(timeout, nil, func(transport *http.Transport) http.RoundTripper {
+		applied = true
+		return transport
+	})
 
 	require.NotNil(t, client)
 	assert.Equal(t, 0*time.Second, client.Timeout)
+	assert.True(t, applied)
 }
 
 func TestProblemJSON_Marshal(t *testing.T) {
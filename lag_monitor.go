@@ -0,0 +1,462 @@
+package nakadi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const defaultLagInterval = time.Minute
+
+// LagTrend describes how the lag of a subscription or partition developed since the previous check.
+type LagTrend int
+
+// Possible values of LagTrend.
+const (
+	LagTrendUnknown LagTrend = iota
+	LagTrendStable
+	LagTrendGrowing
+	LagTrendShrinking
+)
+
+// String implements fmt.Stringer for LagTrend.
+func (t LagTrend) String() string {
+	switch t {
+	case LagTrendStable:
+		return "stable"
+	case LagTrendGrowing:
+		return "growing"
+	case LagTrendShrinking:
+		return "shrinking"
+	default:
+		return "unknown"
+	}
+}
+
+func newLagTrend(previous, current int, known bool) LagTrend {
+	switch {
+	case !known:
+		return LagTrendUnknown
+	case current > previous:
+		return LagTrendGrowing
+	case current < previous:
+		return LagTrendShrinking
+	default:
+		return LagTrendStable
+	}
+}
+
+// LagReport contains the lag of a single subscription at a certain point in time.
+type LagReport struct {
+	SubscriptionID string
+	Time           time.Time
+	TotalLag       int
+	Trend          LagTrend
+	Partitions     []*PartitionLag
+}
+
+// PartitionLag contains the lag of a single partition of a subscription.
+type PartitionLag struct {
+	EventType string
+	Partition string
+	State     string
+	StreamID  string
+	Lag       int
+	Trend     LagTrend
+}
+
+// LagAlert is emitted when the lag of a subscription or one of its partitions exceeds the configured
+// threshold. Once the lag falls below the threshold again, another alert with Resolved set to true is
+// emitted. For alerts concerning the total lag of a subscription EventType and Partition are empty.
+type LagAlert struct {
+	SubscriptionID string
+	EventType      string
+	Partition      string
+	Lag            int
+	Threshold      int
+	Resolved       bool
+}
+
+// A LagSink receives the lag reports produced by a LagMonitor.
+type LagSink interface {
+	RecordLag(report *LagReport)
+}
+
+// LagSinkFunc is an adapter that allows the use of ordinary functions as LagSink.
+type LagSinkFunc func(report *LagReport)
+
+// RecordLag implements LagSink for LagSinkFunc.
+func (f LagSinkFunc) RecordLag(report *LagReport) {
+	f(report)
+}
+
+// LagMonitorOptions contains optional parameters that are used to create a LagMonitor.
+type LagMonitorOptions struct {
+	// The interval in which subscription stats are fetched from Nakadi (default: 1 minute)
+	Interval time.Duration
+	// Sinks receive every lag report produced by the monitor.
+	Sinks []LagSink
+	// If the total lag of a subscription exceeds this value an alert is emitted. 0 disables the
+	// threshold (default: 0)
+	TotalLagThreshold int
+	// If the lag of a single partition exceeds this value an alert is emitted. 0 disables the
+	// threshold. Once a partition is no longer reported in the stats, its alert is discarded without
+	// emitting a resolved alert (default: 0)
+	PartitionLagThreshold int
+	// OnAlert is called whenever a threshold is exceeded or an exceeded threshold is no longer exceeded.
+	OnAlert func(LagAlert)
+	// NotifyErr is called when the stats of a subscription could not be fetched. The first parameter is
+	// the respective subscription ID.
+	NotifyErr func(string, error)
+	// The options used to create the SubscriptionAPI that fetches the stats. The options may be nil.
+	SubscriptionOptions *SubscriptionOptions
+}
+
+func (o *LagMonitorOptions) withDefaults() *LagMonitorOptions {
+	var copyOptions LagMonitorOptions
+	if o != nil {
+		copyOptions = *o
+	}
+	if copyOptions.Interval == 0 {
+		copyOptions.Interval = defaultLagInterval
+	}
+	if copyOptions.OnAlert == nil {
+		copyOptions.OnAlert = func(_ LagAlert) {}
+	}
+	if copyOptions.NotifyErr == nil {
+		copyOptions.NotifyErr = func(_ string, _ error) {}
+	}
+	return &copyOptions
+}
+
+// statsAPI is a contract that is used internally in order to be able to mock the SubscriptionAPI
+type statsAPI interface {
+	GetStats(id string) ([]*SubscriptionStats, error)
+}
+
+// NewLagMonitor creates a new LagMonitor that observes the lag of the subscriptions with the given IDs.
+// As for all sub APIs of the `go-nakadi` package NewLagMonitor receives a configured Nakadi client. The
+// last parameter is a struct containing only optional parameters. The options may be nil.
+func NewLagMonitor(client *Client, subscriptionIDs []string, options *LagMonitorOptions) *LagMonitor {
+	options = options.withDefaults()
+
+	return &LagMonitor{
+		statsAPI:        NewSubscriptionAPI(client, options.SubscriptionOptions),
+		subscriptionIDs: subscriptionIDs,
+		interval:        options.Interval,
+		sinks:           options.Sinks,
+		totalThreshold:  options.TotalLagThreshold,
+		partThreshold:   options.PartitionLagThreshold,
+		onAlert:         options.OnAlert,
+		notifyErr:       options.NotifyErr,
+		previous:        make(map[string]*LagReport),
+		alerting:        make(map[string]LagAlert)}
+}
+
+// A LagMonitor periodically fetches the stats of a set of subscriptions, computes the total and per
+// partition lag (the number of unconsumed events) and reports it to the configured sinks.
+type LagMonitor struct {
+	sync.Mutex
+	statsAPI        statsAPI
+	subscriptionIDs []string
+	interval        time.Duration
+	sinks           []LagSink
+	totalThreshold  int
+	partThreshold   int
+	onAlert         func(LagAlert)
+	notifyErr       func(string, error)
+	stateMutex      sync.Mutex
+	previous        map[string]*LagReport
+	alerting        map[string]LagAlert
+	isStarted       bool
+	cancel          context.CancelFunc
+	done            chan struct{}
+}
+
+// Start begins to monitor the subscriptions in the configured interval. The first check is performed
+// immediately. Start returns an error if the monitor was already started. A stopped monitor can be
+// started again.
+func (m *LagMonitor) Start() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.isStarted {
+		return errors.New("lag monitor was already started")
+	}
+	m.isStarted = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.done = make(chan struct{})
+	go m.run(ctx, m.done)
+
+	return nil
+}
+
+// Stop halts the monitor. Stop returns an error if the monitor is not running.
+func (m *LagMonitor) Stop() error {
+	m.Lock()
+	defer m.Unlock()
+
+	if !m.isStarted {
+		return errors.New("lag monitor is not running")
+	}
+
+	m.cancel()
+	<-m.done
+	m.isStarted = false
+
+	return nil
+}
+
+func (m *LagMonitor) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		_, _ = m.Check()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// nothing
+		}
+	}
+}
+
+// Check fetches the stats of all monitored subscriptions once and passes the resulting reports to the
+// configured sinks. Reports of subscriptions whose stats could not be fetched are omitted and the
+// last error is returned. Check can also be used without starting the monitor.
+func (m *LagMonitor) Check() ([]*LagReport, error) {
+	var reports []*LagReport
+	var lastErr error
+
+	for _, id := range m.subscriptionIDs {
+		stats, err := m.statsAPI.GetStats(id)
+		if err != nil {
+			lastErr = err
+			m.notifyErr(id, err)
+			continue
+		}
+
+		report := m.record(id, stats, time.Now())
+		for _, sink := range m.sinks {
+			sink.RecordLag(report)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, lastErr
+}
+
+// record computes a lag report from subscription stats and emits alerts if necessary.
+func (m *LagMonitor) record(id string, stats []*SubscriptionStats, now time.Time) *LagReport {
+	m.stateMutex.Lock()
+	defer m.stateMutex.Unlock()
+
+	previous, known := m.previous[id]
+	previousLag := make(map[string]int)
+	if known {
+		for _, p := range previous.Partitions {
+			previousLag[p.EventType+"/"+p.Partition] = p.Lag
+		}
+	}
+
+	report := &LagReport{SubscriptionID: id, Time: now}
+	reported := make(map[string]bool)
+	for _, stat := range stats {
+		for _, partition := range stat.Partitions {
+			prevLag, partKnown := previousLag[stat.EventType+"/"+partition.Partition]
+			lag := &PartitionLag{
+				EventType: stat.EventType,
+				Partition: partition.Partition,
+				State:     partition.State,
+				StreamID:  partition.StreamID,
+				Lag:       partition.UnconsumedEvents,
+				Trend:     newLagTrend(prevLag, partition.UnconsumedEvents, partKnown)}
+			report.Partitions = append(report.Partitions, lag)
+			report.TotalLag += lag.Lag
+
+			if m.partThreshold > 0 {
+				reported[alertKey(id, lag.EventType, lag.Partition)] = true
+				m.alert(LagAlert{
+					SubscriptionID: id,
+					EventType:      lag.EventType,
+					Partition:      lag.Partition,
+					Lag:            lag.Lag,
+					Threshold:      m.partThreshold})
+			}
+		}
+	}
+	for key, partition := range m.alerting {
+		if partition.SubscriptionID == id && partition.Partition != "" && !reported[key] {
+			delete(m.alerting, key)
+		}
+	}
+	if known {
+		report.Trend = newLagTrend(previous.TotalLag, report.TotalLag, true)
+	}
+	if m.totalThreshold > 0 {
+		m.alert(LagAlert{SubscriptionID: id, Lag: report.TotalLag, Threshold: m.totalThreshold})
+	}
+
+	m.previous[id] = report
+	return report
+}
+
+// alert emits an alert if the lag exceeds the threshold for the first time or if the lag was reduced
+// below the threshold after an alert was emitted before.
+func (m *LagMonitor) alert(alert LagAlert) {
+	key := alertKey(alert.SubscriptionID, alert.EventType, alert.Partition)
+	_, alerting := m.alerting[key]
+	exceeded := alert.Lag > alert.Threshold
+
+	switch {
+	case exceeded && !alerting:
+		m.alerting[key] = alert
+		m.onAlert(alert)
+	case !exceeded && alerting:
+		delete(m.alerting, key)
+		alert.Resolved = true
+		m.onAlert(alert)
+	}
+}
+
+func alertKey(subscriptionID, eventType, partition string) string {
+	return subscriptionID + "/" + eventType + "/" + partition
+}
+
+// NewOTelLagSink creates a LagSink which records the lag as OpenTelemetry gauges using a meter obtained
+// from the given meter provider.
+func NewOTelLagSink(provider metric.MeterProvider) (LagSink, error) {
+	meter := provider.Meter(instrumentationName)
+
+	totalLag, err := meter.Int64Gauge("nakadi.subscription.lag",
+		metric.WithDescription("The number of unconsumed events of a subscription"),
+		metric.WithUnit("{event}"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create lag sink")
+	}
+	partitionLag, err := meter.Int64Gauge("nakadi.subscription.partition.lag",
+		metric.WithDescription("The number of unconsumed events of a single partition of a subscription"),
+		metric.WithUnit("{event}"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create lag sink")
+	}
+	trend, err := meter.Int64Gauge("nakadi.subscription.lag.trend",
+		metric.WithDescription("The lag trend of a subscription: 1 growing, 0 stable, -1 shrinking"))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create lag sink")
+	}
+
+	return &otelLagSink{totalLag: totalLag, partitionLag: partitionLag, trend: trend}, nil
+}
+
+// otelLagSink implements the LagSink interface.
+type otelLagSink struct {
+	totalLag     metric.Int64Gauge
+	partitionLag metric.Int64Gauge
+	trend        metric.Int64Gauge
+}
+
+func (s *otelLagSink) RecordLag(report *LagReport) {
+	ctx := context.Background()
+	subscription := attribute.String("nakadi.subscription.id", report.SubscriptionID)
+
+	s.totalLag.Record(ctx, int64(report.TotalLag), metric.WithAttributes(subscription))
+	s.trend.Record(ctx, trendValue(report.Trend), metric.WithAttributes(subscription))
+	for _, p := range report.Partitions {
+		s.partitionLag.Record(ctx, int64(p.Lag), metric.WithAttributes(
+			subscription,
+			attribute.String("nakadi.event_type", p.EventType),
+			attribute.String("nakadi.partition", p.Partition)))
+	}
+}
+
+func trendValue(trend LagTrend) int64 {
+	switch trend {
+	case LagTrendGrowing:
+		return 1
+	case LagTrendShrinking:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// NewPrometheusLagSink creates a LagSink that keeps the latest report of each subscription and serves
+// them in the Prometheus text exposition format via ServeHTTP.
+func NewPrometheusLagSink() *PrometheusLagSink {
+	return &PrometheusLagSink{reports: make(map[string]*LagReport)}
+}
+
+// PrometheusLagSink is a LagSink which also implements http.Handler. It can be used to expose the lag
+// to a Prometheus compatible scraper.
+type PrometheusLagSink struct {
+	sync.Mutex
+	reports map[string]*LagReport
+}
+
+// RecordLag implements LagSink for PrometheusLagSink.
+func (s *PrometheusLagSink) RecordLag(report *LagReport) {
+	s.Lock()
+	defer s.Unlock()
+	s.reports[report.SubscriptionID] = report
+}
+
+// ServeHTTP implements http.Handler for PrometheusLagSink.
+func (s *PrometheusLagSink) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.writeTo(w)
+}
+
+func (s *PrometheusLagSink) writeTo(w io.Writer) {
+	s.Lock()
+	defer s.Unlock()
+
+	ids := make([]string, 0, len(s.reports))
+	for id := range s.reports {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	_, _ = fmt.Fprintln(w, "# HELP nakadi_subscription_lag The number of unconsumed events of a subscription.")
+	_, _ = fmt.Fprintln(w, "# TYPE nakadi_subscription_lag gauge")
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(w, "nakadi_subscription_lag{subscription_id=\"%s\"} %d\n", escapeLabel(id), s.reports[id].TotalLag)
+	}
+
+	_, _ = fmt.Fprintln(w, "# HELP nakadi_subscription_lag_trend The lag trend of a subscription: 1 growing, 0 stable, -1 shrinking.")
+	_, _ = fmt.Fprintln(w, "# TYPE nakadi_subscription_lag_trend gauge")
+	for _, id := range ids {
+		_, _ = fmt.Fprintf(w, "nakadi_subscription_lag_trend{subscription_id=\"%s\"} %d\n", escapeLabel(id), trendValue(s.reports[id].Trend))
+	}
+
+	_, _ = fmt.Fprintln(w, "# HELP nakadi_subscription_partition_lag The number of unconsumed events of a partition.")
+	_, _ = fmt.Fprintln(w, "# TYPE nakadi_subscription_partition_lag gauge")
+	for _, id := range ids {
+		for _, p := range s.reports[id].Partitions {
+			_, _ = fmt.Fprintf(w, "nakadi_subscription_partition_lag{subscription_id=\"%s\",event_type=\"%s\",partition=\"%s\"} %d\n",
+				escapeLabel(id), escapeLabel(p.EventType), escapeLabel(p.Partition), p.Lag)
+		}
+	}
+}
+
+// labelEscaper escapes label values as required by the Prometheus text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
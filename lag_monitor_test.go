@@ -0,0 +1,250 @@
+package nakadi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestLagMonitor_Check(t *testing.T) {
+	id := "7dd69d58-7f20-11e7-9748-133d6a0dbfb3"
+
+	t.Run("fail to get stats", func(t *testing.T) {
+		var notified error
+		monitor, stats := setupMockLagMonitor([]string{id}, &LagMonitorOptions{
+			NotifyErr: func(_ string, err error) { notified = err }})
+		stats.On("GetStats", id).Once().Return(nil, assert.AnError)
+
+		reports, err := monitor.Check()
+		assert.Equal(t, assert.AnError, err)
+		assert.Equal(t, assert.AnError, notified)
+		assert.Empty(t, reports)
+	})
+
+	t.Run("success with trend", func(t *testing.T) {
+		var recorded []*LagReport
+		monitor, stats := setupMockLagMonitor([]string{id}, &LagMonitorOptions{
+			Sinks: []LagSink{LagSinkFunc(func(report *LagReport) { recorded = append(recorded, report) })}})
+		stats.On("GetStats", id).Once().Return(helperLagStats(10, 5), nil)
+		stats.On("GetStats", id).Once().Return(helperLagStats(20, 5), nil)
+		stats.On("GetStats", id).Once().Return(helperLagStats(2, 3), nil)
+
+		reports, err := monitor.Check()
+		require.NoError(t, err)
+		require.Len(t, reports, 1)
+		assert.Equal(t, 15, reports[0].TotalLag)
+		assert.Equal(t, LagTrendUnknown, reports[0].Trend)
+		assert.Equal(t, LagTrendUnknown, reports[0].Partitions[0].Trend)
+
+		reports, err = monitor.Check()
+		require.NoError(t, err)
+		assert.Equal(t, 25, reports[0].TotalLag)
+		assert.Equal(t, LagTrendGrowing, reports[0].Trend)
+		assert.Equal(t, LagTrendGrowing, reports[0].Partitions[0].Trend)
+		assert.Equal(t, LagTrendStable, reports[0].Partitions[1].Trend)
+
+		reports, err = monitor.Check()
+		require.NoError(t, err)
+		assert.Equal(t, 5, reports[0].TotalLag)
+		assert.Equal(t, LagTrendShrinking, reports[0].Trend)
+		assert.Equal(t, LagTrendShrinking, reports[0].Partitions[1].Trend)
+
+		assert.Len(t, recorded, 3)
+	})
+
+	t.Run("success with alerts", func(t *testing.T) {
+		var alerts []LagAlert
+		monitor, stats := setupMockLagMonitor([]string{id}, &LagMonitorOptions{
+			TotalLagThreshold:     20,
+			PartitionLagThreshold: 10,
+			OnAlert:               func(alert LagAlert) { alerts = append(alerts, alert) }})
+		stats.On("GetStats", id).Once().Return(helperLagStats(10, 5), nil)
+		stats.On("GetStats", id).Once().Return(helperLagStats(20, 5), nil)
+		stats.On("GetStats", id).Once().Return(helperLagStats(30, 5), nil)
+		stats.On("GetStats", id).Once().Return(helperLagStats(2, 3), nil)
+
+		for i := 0; i < 4; i++ {
+			_, err := monitor.Check()
+			require.NoError(t, err)
+		}
+
+		expected := []LagAlert{
+			{SubscriptionID: id, EventType: "test-event.data", Partition: "0", Lag: 20, Threshold: 10},
+			{SubscriptionID: id, Lag: 25, Threshold: 20},
+			{SubscriptionID: id, EventType: "test-event.data", Partition: "0", Lag: 2, Threshold: 10, Resolved: true},
+			{SubscriptionID: id, Lag: 5, Threshold: 20, Resolved: true},
+		}
+		assert.Equal(t, expected, alerts)
+	})
+
+	t.Run("discard alerts of removed partitions", func(t *testing.T) {
+		var alerts []LagAlert
+		monitor, stats := setupMockLagMonitor([]string{id}, &LagMonitorOptions{
+			PartitionLagThreshold: 10,
+			OnAlert:               func(alert LagAlert) { alerts = append(alerts, alert) }})
+		stats.On("GetStats", id).Once().Return(helperLagStats(5, 20), nil)
+		stats.On("GetStats", id).Once().Return(helperLagStats(5), nil)
+		stats.On("GetStats", id).Once().Return(helperLagStats(5, 30), nil)
+
+		for i := 0; i < 3; i++ {
+			_, err := monitor.Check()
+			require.NoError(t, err)
+			if i == 1 {
+				assert.Empty(t, monitor.alerting)
+			}
+		}
+
+		expected := []LagAlert{
+			{SubscriptionID: id, EventType: "test-event.data", Partition: "1", Lag: 20, Threshold: 10},
+			{SubscriptionID: id, EventType: "test-event.data", Partition: "1", Lag: 30, Threshold: 10},
+		}
+		assert.Equal(t, expected, alerts)
+	})
+}
+
+func TestLagMonitor_StartStop(t *testing.T) {
+	id := "7dd69d58-7f20-11e7-9748-133d6a0dbfb3"
+	reportCh := make(chan *LagReport, 10)
+	monitor, stats := setupMockLagMonitor([]string{id}, &LagMonitorOptions{
+		Interval: 10 * time.Millisecond,
+		Sinks:    []LagSink{LagSinkFunc(func(report *LagReport) { reportCh <- report })}})
+	stats.On("GetStats", id).Return(helperLagStats(10, 5), nil)
+
+	assert.Error(t, monitor.Stop())
+	require.NoError(t, monitor.Start())
+	assert.Error(t, monitor.Start())
+
+	receive := func() {
+		for i := 0; i < 2; i++ {
+			select {
+			case report := <-reportCh:
+				assert.Equal(t, 15, report.TotalLag)
+			case <-time.After(time.Second):
+				assert.Fail(t, "no lag report received")
+			}
+		}
+	}
+
+	receive()
+	assert.NoError(t, monitor.Stop())
+	assert.Error(t, monitor.Stop())
+
+	require.NoError(t, monitor.Start())
+	receive()
+	assert.NoError(t, monitor.Stop())
+}
+
+func TestOTelLagSink(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	sink, err := NewOTelLagSink(provider)
+	require.NoError(t, err)
+
+	sink.RecordLag(&LagReport{
+		SubscriptionID: "subscription-id",
+		TotalLag:       15,
+		Trend:          LagTrendGrowing,
+		Partitions: []*PartitionLag{
+			{EventType: "test-event.data", Partition: "0", Lag: 10},
+			{EventType: "test-event.data", Partition: "1", Lag: 5}}})
+
+	data := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &data))
+	require.Len(t, data.ScopeMetrics, 1)
+
+	values := map[string][]int64{}
+	for _, m := range data.ScopeMetrics[0].Metrics {
+		gauge, ok := m.Data.(metricdata.Gauge[int64])
+		require.True(t, ok)
+		for _, point := range gauge.DataPoints {
+			values[m.Name] = append(values[m.Name], point.Value)
+		}
+	}
+
+	assert.Equal(t, []int64{15}, values["nakadi.subscription.lag"])
+	assert.Equal(t, []int64{1}, values["nakadi.subscription.lag.trend"])
+	assert.ElementsMatch(t, []int64{10, 5}, values["nakadi.subscription.partition.lag"])
+}
+
+func TestPrometheusLagSink(t *testing.T) {
+	sink := NewPrometheusLagSink()
+	sink.RecordLag(&LagReport{
+		SubscriptionID: "subscription-id",
+		TotalLag:       15,
+		Trend:          LagTrendShrinking,
+		Partitions: []*PartitionLag{
+			{EventType: "test-event.data", Partition: "0", Lag: 10},
+			{EventType: "test-event.data", Partition: "1", Lag: 5}}})
+
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	body := recorder.Body.String()
+	assert.Contains(t, body, `nakadi_subscription_lag{subscription_id="subscription-id"} 15`)
+	assert.Contains(t, body, `nakadi_subscription_lag_trend{subscription_id="subscription-id"} -1`)
+	assert.Contains(t, body, `nakadi_subscription_partition_lag{subscription_id="subscription-id",event_type="test-event.data",partition="0"} 10`)
+	assert.Contains(t, body, `nakadi_subscription_partition_lag{subscription_id="subscription-id",event_type="test-event.data",partition="1"} 5`)
+}
+
+func TestPrometheusLagSink_escapeLabels(t *testing.T) {
+	sink := NewPrometheusLagSink()
+	sink.RecordLag(&LagReport{
+		SubscriptionID: "subscription-id",
+		Partitions:     []*PartitionLag{{EventType: "tëst\\\"event\"\n", Partition: "0\t", Lag: 10}}})
+
+	recorder := httptest.NewRecorder()
+	sink.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Contains(t, recorder.Body.String(), `event_type="tëst\\\"event\"\n",partition="0`+"\t"+`"} 10`)
+}
+
+func TestLagMonitorOptions_withDefaults(t *testing.T) {
+	options := (*LagMonitorOptions)(nil).withDefaults()
+
+	assert.Equal(t, defaultLagInterval, options.Interval)
+	assert.NotNil(t, options.OnAlert)
+	assert.NotNil(t, options.NotifyErr)
+
+	options = (&LagMonitorOptions{Interval: time.Second}).withDefaults()
+	assert.Equal(t, time.Second, options.Interval)
+}
+
+func setupMockLagMonitor(ids []string, options *LagMonitorOptions) (*LagMonitor, *mockStatsAPI) {
+	stats := &mockStatsAPI{}
+	monitor := NewLagMonitor(&Client{}, ids, options)
+	monitor.statsAPI = stats
+	return monitor, stats
+}
+
+func helperLagStats(lags ...int) []*SubscriptionStats {
+	stats := &SubscriptionStats{EventType: "test-event.data"}
+	for i, lag := range lags {
+		stats.Partitions = append(stats.Partitions, &PartitionStats{
+			Partition:        string(rune('0' + i)),
+			State:            "assigned",
+			UnconsumedEvents: lag})
+	}
+	return []*SubscriptionStats{stats}
+}
+
+type mockStatsAPI struct {
+	mock.Mock
+}
+
+func (s *mockStatsAPI) GetStats(id string) ([]*SubscriptionStats, error) {
+	args := s.Called(id)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*SubscriptionStats), nil
+}
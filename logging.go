@@ -0,0 +1,34 @@
+package nakadi
+
+import (
+	"log/slog"
+	"time"
+)
+
+// discardLogger is used by all sub APIs if no logger was configured.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// log returns the logger of the client, or a logger that discards all records if no logger was configured.
+func (c *Client) log() *slog.Logger {
+	if c == nil || c.logger == nil {
+		return discardLogger
+	}
+	return c.logger
+}
+
+// notifyRetry returns a backoff notify function, which logs failed requests that are going to be retried.
+func (c *Client) notifyRetry(method, url string) func(error, time.Duration) {
+	return func(err error, wait time.Duration) {
+		c.log().Warn("request failed, retrying",
+			"method", method, "url", url, "error", err, "backoff", wait)
+	}
+}
+
+// cursorLogAttrs returns the fields of a cursor as structured log attributes.
+func cursorLogAttrs(cursor Cursor) []any {
+	return []any{
+		"stream_id", cursor.NakadiStreamID,
+		"event_type", cursor.EventType,
+		"partition", cursor.Partition,
+		"offset", cursor.Offset}
+}
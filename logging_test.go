@@ -0,0 +1,126 @@
+package nakadi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_log(t *testing.T) {
+	t.Run("no logger configured", func(t *testing.T) {
+		assert.Same(t, discardLogger, (&Client{}).log())
+		assert.Same(t, discardLogger, New(defaultNakadiURL, nil).log())
+	})
+
+	t.Run("logger configured", func(t *testing.T) {
+		logger, _ := helperJSONLogger()
+		client := New(defaultNakadiURL, &ClientOptions{Logger: logger})
+
+		assert.Same(t, logger, client.log())
+	})
+}
+
+func TestClient_notifyRetry(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	url := "/retry-test"
+	logger, logs := helperJSONLogger()
+	client := &Client{httpClient: http.DefaultClient, logger: logger}
+
+	counter := helperMakeCounter(2)
+	httpmock.RegisterResponder("GET", url, func(r *http.Request) (*http.Response, error) {
+		if <-counter < 1 {
+			return httpmock.NewStringResponse(http.StatusInternalServerError, testProblemJSON), nil
+		}
+		return httpmock.NewStringResponse(http.StatusOK, `{}`), nil
+	})
+
+	err := client.httpGET(context.Background(), &backoff.ZeroBackOff{}, url, &map[string]string{}, "error message")
+	require.NoError(t, err)
+
+	records := helperLogRecords(t, logs)
+	require.Len(t, records, 1)
+	assert.Equal(t, "WARN", records[0]["level"])
+	assert.Equal(t, "request failed, retrying", records[0]["msg"])
+	assert.Equal(t, "GET", records[0]["method"])
+	assert.Equal(t, url, records[0]["url"])
+	assert.Regexp(t, "error message", records[0]["error"])
+}
+
+func TestStreamAPI_logging(t *testing.T) {
+	cursor := Cursor{NakadiStreamID: "stream-id", EventType: "test-event", Partition: "2", Offset: "42"}
+
+	t.Run("failed commit", func(t *testing.T) {
+		logger, logs := helperJSONLogger()
+		streamAPI, opener, committer := setupMockStream(nil, nil)
+		streamAPI.logger = logger.With("subscription_id", testSubscriptionID)
+		streamAPI.commitBackOffConf = backOffConfiguration{}
+		opener.On("openStream").Return(nil, assert.AnError).Maybe()
+		committer.On("commitCursor", cursor).Return(assert.AnError)
+		defer streamAPI.Close()
+
+		err := streamAPI.CommitCursor(cursor)
+		require.Error(t, err)
+
+		var records []map[string]interface{}
+		for _, record := range helperLogRecords(t, logs) {
+			if record["msg"] == "unable to commit cursor" {
+				records = append(records, record)
+			}
+		}
+		require.Len(t, records, 1)
+		assert.Equal(t, "ERROR", records[0]["level"])
+		assert.Equal(t, testSubscriptionID, records[0]["subscription_id"])
+		assert.Equal(t, "stream-id", records[0]["stream_id"])
+		assert.Equal(t, "test-event", records[0]["event_type"])
+		assert.Equal(t, "2", records[0]["partition"])
+		assert.Equal(t, "42", records[0]["offset"])
+		assert.Equal(t, assert.AnError.Error(), records[0]["error"])
+	})
+}
+
+// syncBuffer is a bytes.Buffer which can be written and read concurrently.
+type syncBuffer struct {
+	sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.Lock()
+	defer b.Unlock()
+	return append([]byte(nil), b.buffer.Bytes()...)
+}
+
+func helperJSONLogger() (*slog.Logger, *syncBuffer) {
+	buffer := &syncBuffer{}
+	return slog.New(slog.NewJSONHandler(buffer, &slog.HandlerOptions{Level: slog.LevelDebug})), buffer
+}
+
+func helperLogRecords(t *testing.T, buffer *syncBuffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buffer.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		record := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(line, &record))
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,175 @@
+package nakadi
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.31.0"
+)
+
+const instrumentationName = "github.com/stoewer/go-nakadi"
+
+// clientMetrics holds all instruments used by a client and its sub APIs. A nil *clientMetrics is valid
+// and records nothing.
+type clientMetrics struct {
+	requestDuration  metric.Float64Histogram
+	publishedEvents  metric.Int64Counter
+	failedItems      metric.Int64Counter
+	streamReconnects metric.Int64Counter
+	batchesReceived  metric.Int64Counter
+	commitDuration   metric.Float64Histogram
+	commitFailures   metric.Int64Counter
+	batchQueueDepth  metric.Int64UpDownCounter
+}
+
+// newClientMetrics creates all instruments using a meter from the given provider. Errors during the
+// creation of instruments are passed to the global OpenTelemetry error handler.
+func newClientMetrics(provider metric.MeterProvider) *clientMetrics {
+	meter := provider.Meter(instrumentationName)
+	m := &clientMetrics{}
+
+	var err error
+	m.requestDuration, err = meter.Float64Histogram("nakadi.client.request.duration",
+		metric.WithDescription("Duration of requests sent to Nakadi"),
+		metric.WithUnit("s"))
+	handleMetricErr(err)
+	m.publishedEvents, err = meter.Int64Counter("nakadi.publish.events",
+		metric.WithDescription("Number of events sent to Nakadi for publishing"),
+		metric.WithUnit("{event}"))
+	handleMetricErr(err)
+	m.failedItems, err = meter.Int64Counter("nakadi.publish.failed_items",
+		metric.WithDescription("Number of events Nakadi reported as not published"),
+		metric.WithUnit("{event}"))
+	handleMetricErr(err)
+	m.streamReconnects, err = meter.Int64Counter("nakadi.stream.reconnects",
+		metric.WithDescription("Number of times a stream was re-opened"),
+		metric.WithUnit("{reconnect}"))
+	handleMetricErr(err)
+	m.batchesReceived, err = meter.Int64Counter("nakadi.stream.batches",
+		metric.WithDescription("Number of non empty batches received from a stream"),
+		metric.WithUnit("{batch}"))
+	handleMetricErr(err)
+	m.commitDuration, err = meter.Float64Histogram("nakadi.stream.commit.duration",
+		metric.WithDescription("Duration of cursor commits including retries"),
+		metric.WithUnit("s"))
+	handleMetricErr(err)
+	m.commitFailures, err = meter.Int64Counter("nakadi.stream.commit.failures",
+		metric.WithDescription("Number of cursor commits that failed"),
+		metric.WithUnit("{commit}"))
+	handleMetricErr(err)
+	m.batchQueueDepth, err = meter.Int64UpDownCounter("nakadi.batch.queue.depth",
+		metric.WithDescription("Number of events waiting in the queue of a BatchPublishAPI"),
+		metric.WithUnit("{event}"))
+	handleMetricErr(err)
+
+	return m
+}
+
+func handleMetricErr(err error) {
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+func (m *clientMetrics) recordRequest(operation string, statusCode int, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("nakadi.operation", operation),
+		attribute.String("nakadi.outcome", outcome(err == nil && statusCode < 500))}
+	if statusCode > 0 {
+		attrs = append(attrs, semconv.HTTPResponseStatusCode(statusCode))
+	}
+	m.requestDuration.Record(context.Background(), duration.Seconds(), metric.WithAttributes(attrs...))
+}
+
+func (m *clientMetrics) recordPublish(eventType string, events, failed int) {
+	if m == nil {
+		return
+	}
+	attrs := metric.WithAttributes(attribute.String("nakadi.event_type", eventType))
+	m.publishedEvents.Add(context.Background(), int64(events), attrs)
+	if failed > 0 {
+		m.failedItems.Add(context.Background(), int64(failed), attrs)
+	}
+}
+
+func (m *clientMetrics) recordReconnect(subscriptionID string) {
+	if m == nil {
+		return
+	}
+	m.streamReconnects.Add(context.Background(), 1,
+		metric.WithAttributes(attribute.String("nakadi.subscription.id", subscriptionID)))
+}
+
+func (m *clientMetrics) recordBatch(subscriptionID string) {
+	if m == nil {
+		return
+	}
+	m.batchesReceived.Add(context.Background(), 1,
+		metric.WithAttributes(attribute.String("nakadi.subscription.id", subscriptionID)))
+}
+
+func (m *clientMetrics) recordCommit(subscriptionID string, err error, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	attrs := metric.WithAttributes(
+		attribute.String("nakadi.subscription.id", subscriptionID),
+		attribute.String("nakadi.outcome", outcome(err == nil)))
+	m.commitDuration.Record(context.Background(), duration.Seconds(), attrs)
+	if err != nil {
+		m.commitFailures.Add(context.Background(), 1,
+			metric.WithAttributes(attribute.String("nakadi.subscription.id", subscriptionID)))
+	}
+}
+
+func (m *clientMetrics) addQueueDepth(eventType string, delta int64) {
+	if m == nil {
+		return
+	}
+	m.batchQueueDepth.Add(context.Background(), delta,
+		metric.WithAttributes(attribute.String("nakadi.event_type", eventType)))
+}
+
+func outcome(success bool) string {
+	if success {
+		return "success"
+	}
+	return "error"
+}
+
+// metricsTransport is a http.RoundTripper which records the duration and outcome of each request.
+type metricsTransport struct {
+	next    http.RoundTripper
+	metrics *clientMetrics
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	start := time.Now()
+	rsp, err := next.RoundTrip(req)
+
+	var statusCode int
+	if rsp != nil {
+		statusCode = rsp.StatusCode
+	}
+	t.metrics.recordRequest(getOperationName(req.URL.Path, req.Method), statusCode, err, time.Since(start))
+
+	return rsp, err
+}
+
+func (t *metricsTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
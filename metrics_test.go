@@ -0,0 +1,141 @@
+package nakadi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestMetricsTransport(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	client := New(server.URL, &ClientOptions{MeterProvider: provider})
+	require.IsType(t, &metricsTransport{}, client.httpClient.Transport)
+
+	_, err := NewSubscriptionAPI(client, nil).List()
+	require.NoError(t, err)
+	err = NewSubscriptionAPI(client, nil).Delete("id")
+	require.Error(t, err)
+
+	data := helperCollectMetrics(t, reader)
+	histogram, ok := data["nakadi.client.request.duration"].Data.(metricdata.Histogram[float64])
+	require.True(t, ok)
+	require.Len(t, histogram.DataPoints, 2)
+
+	outcomes := map[string]string{}
+	for _, point := range histogram.DataPoints {
+		operation, _ := point.Attributes.Value("nakadi.operation")
+		result, _ := point.Attributes.Value("nakadi.outcome")
+		outcomes[operation.AsString()] = result.AsString()
+		assert.Equal(t, uint64(1), point.Count)
+	}
+	assert.Equal(t, map[string]string{"get_subscription": "success", "delete_subscription": "error"}, outcomes)
+}
+
+func TestPublishAPI_metrics(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient, metrics: newClientMetrics(provider)}
+	api := NewPublishAPI(client, "test-event.data", nil)
+	url := fmt.Sprintf("%s/event-types/test-event.data/events", defaultNakadiURL)
+	events := []DataChangeEvent{{}, {}, {}}
+
+	httpmock.RegisterResponder("POST", url, httpmock.NewStringResponder(http.StatusOK, ""))
+	require.NoError(t, api.Publish(events))
+
+	httpmock.RegisterResponder("POST", url, httpmock.NewStringResponder(http.StatusMultiStatus,
+		`[{"publishing_status":"submitted"},{"publishing_status":"failed"},{"publishing_status":"aborted"}]`))
+	require.Error(t, api.Publish(events))
+
+	data := helperCollectMetrics(t, reader)
+	assert.Equal(t, int64(6), helperSumCounter(t, data["nakadi.publish.events"]))
+	assert.Equal(t, int64(2), helperSumCounter(t, data["nakadi.publish.failed_items"]))
+}
+
+func TestClientMetrics(t *testing.T) {
+	t.Run("nil metrics", func(t *testing.T) {
+		var metrics *clientMetrics
+		assert.NotPanics(t, func() {
+			metrics.recordRequest("get_event", http.StatusOK, nil, time.Second)
+			metrics.recordPublish("test-event.data", 1, 0)
+			metrics.recordReconnect("id")
+			metrics.recordBatch("id")
+			metrics.recordCommit("id", nil, time.Second)
+			metrics.addQueueDepth("test-event.data", 1)
+		})
+	})
+
+	t.Run("stream metrics", func(t *testing.T) {
+		reader := sdkmetric.NewManualReader()
+		metrics := newClientMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+		metrics.recordReconnect("id")
+		metrics.recordBatch("id")
+		metrics.recordBatch("id")
+		metrics.recordCommit("id", nil, time.Millisecond)
+		metrics.recordCommit("id", assert.AnError, time.Millisecond)
+		metrics.addQueueDepth("test-event.data", 3)
+		metrics.addQueueDepth("test-event.data", -1)
+
+		data := helperCollectMetrics(t, reader)
+		assert.Equal(t, int64(1), helperSumCounter(t, data["nakadi.stream.reconnects"]))
+		assert.Equal(t, int64(2), helperSumCounter(t, data["nakadi.stream.batches"]))
+		assert.Equal(t, int64(1), helperSumCounter(t, data["nakadi.stream.commit.failures"]))
+		assert.Equal(t, int64(2), helperSumCounter(t, data["nakadi.batch.queue.depth"]))
+
+		histogram, ok := data["nakadi.stream.commit.duration"].Data.(metricdata.Histogram[float64])
+		require.True(t, ok)
+		assert.Len(t, histogram.DataPoints, 2)
+		for _, point := range histogram.DataPoints {
+			assert.True(t, point.Attributes.HasValue(attribute.Key("nakadi.subscription.id")))
+		}
+	})
+}
+
+func helperCollectMetrics(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Metrics {
+	data := metricdata.ResourceMetrics{}
+	require.NoError(t, reader.Collect(context.Background(), &data))
+
+	metrics := map[string]metricdata.Metrics{}
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+func helperSumCounter(t *testing.T, m metricdata.Metrics) int64 {
+	sum, ok := m.Data.(metricdata.Sum[int64])
+	require.True(t, ok, "metric %s is not an int64 sum", m.Name)
+
+	var total int64
+	for _, point := range sum.DataPoints {
+		total += point.Value
+	}
+	return total
+}
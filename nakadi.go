@@ -16,13 +16,16 @@ package nakadi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/metric"
 )
 
 const (
@@ -37,9 +40,15 @@ const (
 type Client struct {
 	nakadiURL        string
 	tokenProvider    func() (string, error)
+	tokenInvalidator func()
 	timeout          time.Duration
 	httpClient       *http.Client
 	httpStreamClient *http.Client
+	metrics          *clientMetrics
+	logger           *slog.Logger
+	rateLimiter      *rateLimiter
+	breaker          *circuitBreaker
+	endpoints        *endpoints
 }
 
 // Middleware provides a chainable http.RoundTripper middleware that can be used
@@ -51,6 +60,50 @@ type ClientOptions struct {
 	TokenProvider     func() (string, error)
 	ConnectionTimeout time.Duration
 	Middleware        Middleware
+	// TokenInvalidator is called when Nakadi rejects a token with 401 Unauthorized, before a new token
+	// is obtained from the TokenProvider and the request is retried once. It can be used to discard
+	// cached tokens e.g. by passing the Invalidate method of a CachingTokenProvider.
+	TokenInvalidator func()
+	// Transport configures TLS, proxies and connection pooling of the http transports used for
+	// streaming and non-streaming requests. The options may be nil.
+	Transport *TransportOptions
+	// StreamMiddleware is applied to the transport used for streaming requests. If no stream middleware
+	// is set, Middleware is used for streaming requests as well.
+	StreamMiddleware Middleware
+	// HTTPClient replaces the http client used for non-streaming requests. The client is used as is,
+	// neither ConnectionTimeout, Transport nor Middleware are applied to it.
+	HTTPClient *http.Client
+	// HTTPStreamClient replaces the http client used for streaming requests. The client is used as is,
+	// neither ConnectionTimeout, Transport nor StreamMiddleware are applied to it. The client should
+	// not have a timeout, since it would limit the lifetime of a stream.
+	HTTPStreamClient *http.Client
+	// MeterProvider is used to record metrics of the client and all sub APIs. If no meter provider
+	// is set, no metrics are recorded.
+	MeterProvider metric.MeterProvider
+	// Logger is used by the client and all sub APIs to log retries, reconnects, failed commits and
+	// other events, which do not surface as errors. If no logger is set, nothing is logged.
+	Logger *slog.Logger
+	// RateLimit limits the requests sent by the client and all sub APIs except for streaming requests
+	// and cursor commits. Events are counted when published via PublishAPI. Each retry of a request
+	// counts as another request, so retries can't exceed the limit. Sending a request to failover URLs
+	// after the active URL failed counts as a single request. If no rate limit is set, the client does
+	// not limit requests.
+	RateLimit *RateLimit
+	// CircuitBreaker enables a circuit breaker for all requests of the client and its sub APIs. While
+	// the breaker is open, requests fail fast with a CircuitOpenError. With failover URLs, each URL has
+	// its own breaker and requests fail over to the next URL while the breaker of the active URL is
+	// open. If the options are nil, no circuit breaker is used.
+	CircuitBreaker *CircuitBreakerOptions
+	// FailoverURLs are the URLs of secondary Nakadi instances in the order of preference. Management and
+	// publish requests fail over to the next URL on connection errors or responses with a status code of
+	// 500 or above. Streams and cursor commits are always sent to the primary URL.
+	FailoverURLs []string
+	// FailbackInterval is the time after a failover when a request is sent to the primary URL as probe.
+	// If the probe succeeds, requests are sent to the primary URL again, otherwise the next probe is sent
+	// after another interval (default: 1 minute)
+	FailbackInterval time.Duration
+	// OnFailover is called whenever management and publish requests are routed to a different URL.
+	OnFailover func(from, to string)
 }
 
 func (o *ClientOptions) withDefaults() *ClientOptions {
@@ -64,6 +117,12 @@ func (o *ClientOptions) withDefaults() *ClientOptions {
 	if copyOptions.Middleware == nil {
 		copyOptions.Middleware = func(transport *http.Transport) http.RoundTripper { return transport }
 	}
+	if copyOptions.FailbackInterval == 0 {
+		copyOptions.FailbackInterval = defaultFailbackInterval
+	}
+	if copyOptions.StreamMiddleware == nil {
+		copyOptions.StreamMiddleware = copyOptions.Middleware
+	}
 	return &copyOptions
 }
 
@@ -77,46 +136,153 @@ func New(url string, options *ClientOptions) *Client {
 		nakadiURL:        url,
 		timeout:          options.ConnectionTimeout,
 		tokenProvider:    options.TokenProvider,
-		httpClient:       newHTTPClient(options.ConnectionTimeout, options.Middleware),
-		httpStreamClient: newHTTPStream(options.ConnectionTimeout)}
+		tokenInvalidator: options.TokenInvalidator,
+		httpClient:       options.HTTPClient,
+		httpStreamClient: options.HTTPStreamClient,
+		logger:           options.Logger,
+		rateLimiter:      newRateLimiter(options.RateLimit)}
+	client.breaker = newCircuitBreaker(options.CircuitBreaker, client.log())
+	client.endpoints = newEndpoints(url, options.FailoverURLs, options.FailbackInterval, options.OnFailover, client.log())
+	if client.endpoints != nil && options.CircuitBreaker != nil {
+		for _, u := range client.endpoints.urls[1:] {
+			client.endpoints.breakers = append(client.endpoints.breakers,
+				newCircuitBreaker(options.CircuitBreaker, client.log().With("nakadi_url", u)))
+		}
+	}
+
+	if client.httpClient == nil {
+		client.httpClient = newHTTPClient(options.ConnectionTimeout, options.Transport, options.Middleware)
+	}
+	if client.httpStreamClient == nil {
+		client.httpStreamClient = newHTTPStream(options.ConnectionTimeout, options.Transport, options.StreamMiddleware)
+	}
+
+	if options.MeterProvider != nil {
+		client.metrics = newClientMetrics(options.MeterProvider)
+
+		// copy the http client in order to not modify a client provided via options
+		httpClient := *client.httpClient
+		httpClient.Transport = &metricsTransport{next: httpClient.Transport, metrics: client.metrics}
+		client.httpClient = &httpClient
+	}
 
 	return client
 }
 
+// CircuitState returns the state of the circuit breaker of the client. With failover URLs, each URL has its
+// own circuit breaker and CircuitState returns the state of the breaker of the primary URL. If the client
+// has no circuit breaker, CircuitState always returns CircuitClosed.
+func (c *Client) CircuitState() CircuitState {
+	return c.breaker.State()
+}
+
+// authorize adds an authorization header with a token obtained from the token provider to the request.
+func (c *Client) authorize(request *http.Request) error {
+	if c.tokenProvider == nil {
+		return nil
+	}
+	token, err := c.tokenProvider()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// do sends an authorized request using the given http client. The X-Flow-Id header is set if not
+// already present. If Nakadi rejects the token with 401
+// Unauthorized, the token is invalidated and the request is retried once with a new token. If the
+// circuit breaker of the client is open, do fails with a CircuitOpenError without sending the request.
+func (c *Client) do(httpClient *http.Client, request *http.Request) (*http.Response, error) {
+	return c.doBreaker(c.breaker, httpClient, request)
+}
+
+// doBreaker works like do, but uses the given circuit breaker instead of the breaker of the client.
+func (c *Client) doBreaker(breaker *circuitBreaker, httpClient *http.Client, request *http.Request) (*http.Response, error) {
+	setFlowID(request)
+	if err := breaker.allow(); err != nil {
+		return nil, err
+	}
+	response, err := c.doAuthorized(httpClient, request)
+	breaker.done(response, err)
+	if response != nil && response.Request == nil {
+		response.Request = request
+	}
+	return response, err
+}
+
+// doAuthorized sends a request and retries it once with a new token on 401 Unauthorized.
+func (c *Client) doAuthorized(httpClient *http.Client, request *http.Request) (*http.Response, error) {
+	response, err := httpClient.Do(request)
+	if err != nil || response.StatusCode != http.StatusUnauthorized || c.tokenProvider == nil {
+		return response, err
+	}
+
+	retry := request.Clone(request.Context())
+	if request.Body != nil {
+		if request.GetBody == nil {
+			return response, nil
+		}
+		if retry.Body, err = request.GetBody(); err != nil {
+			return response, nil
+		}
+	}
+
+	if c.tokenInvalidator != nil {
+		c.tokenInvalidator()
+	}
+	if err := c.authorize(retry); err != nil {
+		c.log().Warn("unable to obtain new token after 401 Unauthorized",
+			"method", request.Method, "url", request.URL.String(), "error", err)
+		return response, nil
+	}
+	c.log().Debug("token was rejected, retrying with new token",
+		"method", request.Method, "url", request.URL.String())
+
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+
+	return httpClient.Do(retry)
+}
+
 // httpGET fetches json encoded data with a GET request.
-func (c *Client) httpGET(backOff backoff.BackOff, url string, body interface{}, msg string) error {
+func (c *Client) httpGET(ctx context.Context, backOff backoff.BackOff, url string, body interface{}, msg string) error {
+	ctx = ensureFlowID(ctx)
 	var response *http.Response
-	err := backoff.Retry(func() error {
-		request, err := http.NewRequest("GET", url, nil)
+	err := backoff.RetryNotify(func() error {
+		request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
 		}
 
-		if c.tokenProvider != nil {
-			token, err := c.tokenProvider()
-			if err != nil {
-				return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
-			}
-			request.Header.Set("Authorization", "Bearer "+token)
+		setFlowID(request)
+		if err := c.authorize(request); err != nil {
+			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
+		}
+		if err := c.rateLimiter.wait(ctx, 1, 0); err != nil {
+			return backoff.Permanent(errors.Wrap(err, msg))
 		}
 
-		response, err = c.httpClient.Do(request)
+		response, err = c.doFailover(request)
+		if isCircuitOpen(err) {
+			return backoff.Permanent(errors.Wrap(err, msg))
+		}
 		if err != nil {
-			return errors.Wrap(err, msg)
+			return withFlowID(errors.Wrap(err, msg), request)
 		}
 
-		if response.StatusCode >= 500 {
+		if isRetryableStatus(backOff, response.StatusCode) {
 			buffer, err := io.ReadAll(response.Body)
 			if err != nil {
 				return errors.Wrapf(err, "%s: unable to read response body", msg)
 			}
-			err = decodeResponseToError(buffer, msg)
+			err = withFlowID(decodeResponseToError(buffer, msg), request)
 			_ = response.Body.Close()
 			return err
 		}
 
 		return nil
-	}, backOff)
+	}, backoff.WithContext(backOff, ctx), c.notifyRetry("GET", url))
 
 	if err != nil {
 		return err
@@ -128,7 +294,7 @@ func (c *Client) httpGET(backOff backoff.BackOff, url string, body interface{},
 		if err != nil {
 			return errors.Wrap(err, "unable to read response body")
 		}
-		return decodeResponseToError(buffer, msg)
+		return withFlowID(decodeResponseToError(buffer, msg), response.Request)
 	}
 
 	err = json.NewDecoder(response.Body).Decode(body)
@@ -140,128 +306,140 @@ func (c *Client) httpGET(backOff backoff.BackOff, url string, body interface{},
 }
 
 // httpPUT sends json encoded data via PUT request and returns a response.
-func (c *Client) httpPUT(backOff backoff.BackOff, url string, body interface{}, msg string) (*http.Response, error) {
+func (c *Client) httpPUT(ctx context.Context, backOff backoff.BackOff, url string, body interface{}, msg string) (*http.Response, error) {
+	ctx = ensureFlowID(ctx)
 	encoded, err := json.Marshal(body)
 	if err != nil {
 		return nil, errors.Wrapf(err, "%s: unable to encode json body", msg)
 	}
 
 	var response *http.Response
-	err = backoff.Retry(func() error {
-		request, err := http.NewRequest("PUT", url, bytes.NewReader(encoded))
+	err = backoff.RetryNotify(func() error {
+		request, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(encoded))
 		if err != nil {
 			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
 		}
 
 		request.Header.Set("Content-Type", "application/json;charset=UTF-8")
-		if c.tokenProvider != nil {
-			token, err := c.tokenProvider()
-			if err != nil {
-				return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
-			}
-			request.Header.Set("Authorization", "Bearer "+token)
+		setFlowID(request)
+		if err := c.authorize(request); err != nil {
+			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
+		}
+		if err := c.rateLimiter.wait(ctx, 1, 0); err != nil {
+			return backoff.Permanent(errors.Wrap(err, msg))
 		}
 
-		response, err = c.httpClient.Do(request)
+		response, err = c.doFailover(request)
+		if isCircuitOpen(err) {
+			return backoff.Permanent(errors.Wrap(err, msg))
+		}
 		if err != nil {
-			return errors.Wrap(err, msg)
+			return withFlowID(errors.Wrap(err, msg), request)
 		}
 
-		if response.StatusCode >= 500 {
+		if isRetryableStatus(backOff, response.StatusCode) {
 			buffer, err := io.ReadAll(response.Body)
 			if err != nil {
 				return errors.Wrapf(err, "%s: unable to read response body", msg)
 			}
-			err = decodeResponseToError(buffer, msg)
+			err = withFlowID(decodeResponseToError(buffer, msg), request)
 			_ = response.Body.Close()
 			return err
 		}
 
 		return nil
-	}, backOff)
+	}, backoff.WithContext(backOff, ctx), c.notifyRetry("PUT", url))
 
 	return response, err
 }
 
 // httpPOST sends json encoded data via POST request and returns a response.
-func (c *Client) httpPOST(backOff backoff.BackOff, url string, body interface{}, msg string) (*http.Response, error) {
+func (c *Client) httpPOST(ctx context.Context, backOff backoff.BackOff, url string, body interface{}, msg string) (*http.Response, error) {
+	ctx = ensureFlowID(ctx)
 	encoded, err := json.Marshal(body)
 	if err != nil {
 		return nil, errors.Wrapf(err, "%s: unable to encode json body", msg)
 	}
 
 	var response *http.Response
-	err = backoff.Retry(func() error {
-		request, err := http.NewRequest("POST", url, bytes.NewReader(encoded))
+	err = backoff.RetryNotify(func() error {
+		request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(encoded))
 		if err != nil {
 			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
 		}
 
 		request.Header.Set("Content-Type", "application/json;charset=UTF-8")
-		if c.tokenProvider != nil {
-			token, err := c.tokenProvider()
-			if err != nil {
-				return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
-			}
-			request.Header.Set("Authorization", "Bearer "+token)
+		setFlowID(request)
+		if err := c.authorize(request); err != nil {
+			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
+		}
+		if err := c.rateLimiter.wait(ctx, 1, 0); err != nil {
+			return backoff.Permanent(errors.Wrap(err, msg))
 		}
 
-		response, err = c.httpClient.Do(request)
+		response, err = c.doFailover(request)
+		if isCircuitOpen(err) {
+			return backoff.Permanent(errors.Wrap(err, msg))
+		}
 		if err != nil {
-			return errors.Wrap(err, msg)
+			return withFlowID(errors.Wrap(err, msg), request)
 		}
 
-		if response.StatusCode >= 500 {
+		if isRetryableStatus(backOff, response.StatusCode) {
 			buffer, err := io.ReadAll(response.Body)
 			if err != nil {
 				return errors.Wrapf(err, "%s: unable to read response body", msg)
 			}
-			err = decodeResponseToError(buffer, msg)
+			err = withFlowID(decodeResponseToError(buffer, msg), request)
 			_ = response.Body.Close()
 			return err
 		}
 
 		return nil
-	}, backOff)
+	}, backoff.WithContext(backOff, ctx), c.notifyRetry("POST", url))
 
 	return response, err
 }
 
 // httpDELETE sends a DELETE request. On errors httpDELETE expects a response body to contain
 // an error message in the format of application/problem+json.
-func (c *Client) httpDELETE(backOff backoff.BackOff, url, msg string) error {
+func (c *Client) httpDELETE(ctx context.Context, backOff backoff.BackOff, url, msg string) error {
+	ctx = ensureFlowID(ctx)
 	var response *http.Response
-	err := backoff.Retry(func() error {
-		request, err := http.NewRequest("DELETE", url, nil)
+	err := backoff.RetryNotify(func() error {
+		request, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 		if err != nil {
 			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
 		}
 
-		if c.tokenProvider != nil {
-			token, err := c.tokenProvider()
-			if err != nil {
-				return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
-			}
-			request.Header.Set("Authorization", "Bearer "+token)
+		setFlowID(request)
+		if err := c.authorize(request); err != nil {
+			return backoff.Permanent(errors.Wrapf(err, "%s: unable to prepare request", msg))
+		}
+		if err := c.rateLimiter.wait(ctx, 1, 0); err != nil {
+			return backoff.Permanent(errors.Wrap(err, msg))
 		}
 
-		response, err = c.httpClient.Do(request)
+		response, err = c.doFailover(request)
+		if isCircuitOpen(err) {
+			return backoff.Permanent(errors.Wrap(err, msg))
+		}
 		if err != nil {
-			return errors.Wrap(err, msg)
+			return withFlowID(errors.Wrap(err, msg), request)
 		}
 
-		if response.StatusCode >= 500 {
+		if isRetryableStatus(backOff, response.StatusCode) {
 			buffer, err := io.ReadAll(response.Body)
 			if err != nil {
 				return errors.Wrapf(err, "%s: unable to read response body", msg)
 			}
-			err = decodeResponseToError(buffer, msg)
+			err = withFlowID(decodeResponseToError(buffer, msg), request)
 			_ = response.Body.Close()
 			return err
 		}
 
 		return nil
-	}, backOff)
+	}, backoff.WithContext(backOff, ctx), c.notifyRetry("DELETE", url))
 
 	if err != nil {
 		return err
@@ -273,7 +451,7 @@ func (c *Client) httpDELETE(backOff backoff.BackOff, url, msg string) error {
 		if err != nil {
 			return errors.Wrapf(err, "%s: unable to read response body", msg)
 		}
-		return decodeResponseToError(buffer, msg)
+		return withFlowID(decodeResponseToError(buffer, msg), response.Request)
 	}
 
 	return nil
@@ -1,7 +1,10 @@
 package nakadi
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"strconv"
 	"testing"
@@ -11,6 +14,7 @@ import (
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	noopmetric "go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/trace/noop"
 )
 
@@ -56,6 +60,40 @@ func TestNew(t *testing.T) {
 		assert.Equal(t, defaultTimeOut, client.httpClient.Timeout)
 	})
 
+	t.Run("with stream middleware", func(t *testing.T) {
+		type streamTransport struct{ http.RoundTripper }
+		type requestTransport struct{ http.RoundTripper }
+
+		client := New(defaultNakadiURL, &ClientOptions{
+			Middleware: func(transport *http.Transport) http.RoundTripper { return requestTransport{transport} }})
+
+		assert.IsType(t, requestTransport{}, client.httpClient.Transport)
+		assert.IsType(t, requestTransport{}, client.httpStreamClient.Transport)
+
+		client = New(defaultNakadiURL, &ClientOptions{
+			Middleware:       func(transport *http.Transport) http.RoundTripper { return requestTransport{transport} },
+			StreamMiddleware: func(transport *http.Transport) http.RoundTripper { return streamTransport{transport} }})
+
+		assert.IsType(t, requestTransport{}, client.httpClient.Transport)
+		assert.IsType(t, streamTransport{}, client.httpStreamClient.Transport)
+	})
+
+	t.Run("with custom http clients", func(t *testing.T) {
+		httpClient := &http.Client{}
+		httpStreamClient := &http.Client{}
+
+		client := New(defaultNakadiURL, &ClientOptions{HTTPClient: httpClient, HTTPStreamClient: httpStreamClient})
+
+		assert.Same(t, httpClient, client.httpClient)
+		assert.Same(t, httpStreamClient, client.httpStreamClient)
+
+		client = New(defaultNakadiURL, &ClientOptions{HTTPClient: httpClient, MeterProvider: noopmetric.NewMeterProvider()})
+
+		assert.NotSame(t, httpClient, client.httpClient)
+		assert.Nil(t, httpClient.Transport)
+		assert.IsType(t, &metricsTransport{}, client.httpClient.Transport)
+	})
+
 	t.Run("no options", func(t *testing.T) {
 		url := "https://example.com/nakadi"
 		client := New(url, nil)
@@ -88,7 +126,7 @@ func TestClient_httpGET(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("GET", url, httpmock.NewErrorResponder(assert.AnError))
 
-		err := client.httpGET(&backoff.StopBackOff{}, url, &body, msg)
+		err := client.httpGET(context.Background(), &backoff.StopBackOff{}, url, &body, msg)
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -100,7 +138,7 @@ func TestClient_httpGET(t *testing.T) {
 		client.tokenProvider = func() (string, error) { return "", assert.AnError }
 		httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, encoded))
 
-		err := client.httpGET(&backoff.StopBackOff{}, url, &body, msg)
+		err := client.httpGET(context.Background(), &backoff.StopBackOff{}, url, &body, msg)
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -116,7 +154,7 @@ func TestClient_httpGET(t *testing.T) {
 		})
 		httpmock.RegisterResponder("GET", url, responder)
 
-		err := client.httpGET(&backoff.StopBackOff{}, url, &body, msg)
+		err := client.httpGET(context.Background(), &backoff.StopBackOff{}, url, &body, msg)
 
 		require.Error(t, err)
 		assert.Regexp(t, "unable to read response body", err)
@@ -130,7 +168,7 @@ func TestClient_httpGET(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, encoded), nil
 		})
 
-		err := client.httpGET(&backoff.StopBackOff{}, url, &body, msg)
+		err := client.httpGET(context.Background(), &backoff.StopBackOff{}, url, &body, msg)
 
 		require.NoError(t, err)
 		assert.Equal(t, map[string]string{"key": "value"}, body)
@@ -148,7 +186,7 @@ func TestClient_httpGET(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, encoded), nil
 		})
 
-		err := client.httpGET(&backoff.ZeroBackOff{}, url, &body, msg)
+		err := client.httpGET(context.Background(), &backoff.ZeroBackOff{}, url, &body, msg)
 
 		require.NoError(t, err)
 		assert.Equal(t, map[string]string{"key": "value"}, body)
@@ -167,7 +205,7 @@ func TestClient_httpGET(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, encoded), nil
 		})
 
-		err := client.httpGET(&backoff.ZeroBackOff{}, url, &body, msg)
+		err := client.httpGET(context.Background(), &backoff.ZeroBackOff{}, url, &body, msg)
 
 		require.NoError(t, err)
 		assert.Equal(t, map[string]string{"key": "value"}, body)
@@ -178,7 +216,7 @@ func TestClient_httpGET(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusOK, encoded))
 
-		err := client.httpGET(&backoff.StopBackOff{}, url, &body, msg)
+		err := client.httpGET(context.Background(), &backoff.StopBackOff{}, url, &body, msg)
 
 		require.NoError(t, err)
 		assert.Equal(t, map[string]string{"key": "value"}, body)
@@ -202,7 +240,7 @@ func TestClient_httpPUT(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("PUT", url, httpmock.NewStringResponder(200, ""))
 
-		_, err := client.httpPUT(&backoff.StopBackOff{}, url, brokenMarshaler{}, "error message")
+		_, err := client.httpPUT(context.Background(), &backoff.StopBackOff{}, url, brokenMarshaler{}, "error message")
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -212,7 +250,7 @@ func TestClient_httpPUT(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("PUT", url, httpmock.NewErrorResponder(assert.AnError))
 
-		_, err := client.httpPUT(&backoff.StopBackOff{}, url, &expected, "error message")
+		_, err := client.httpPUT(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -223,7 +261,7 @@ func TestClient_httpPUT(t *testing.T) {
 		client.tokenProvider = func() (string, error) { return "", assert.AnError }
 		httpmock.RegisterResponder("PUT", url, httpmock.NewStringResponder(http.StatusOK, ""))
 
-		_, err := client.httpPUT(&backoff.StopBackOff{}, url, &expected, "error message")
+		_, err := client.httpPUT(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -237,7 +275,7 @@ func TestClient_httpPUT(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPUT(&backoff.StopBackOff{}, url, &expected, "error message")
+		response, err := client.httpPUT(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
@@ -255,7 +293,7 @@ func TestClient_httpPUT(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPUT(&backoff.ZeroBackOff{}, url, &expected, "error message")
+		response, err := client.httpPUT(context.Background(), &backoff.ZeroBackOff{}, url, &expected, "error message")
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
@@ -274,7 +312,7 @@ func TestClient_httpPUT(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPUT(&backoff.ZeroBackOff{}, url, &expected, "error message")
+		response, err := client.httpPUT(context.Background(), &backoff.ZeroBackOff{}, url, &expected, "error message")
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
@@ -291,10 +329,74 @@ func TestClient_httpPUT(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPUT(&backoff.StopBackOff{}, url, &expected, "error message")
+		response, err := client.httpPUT(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
+
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+	})
+}
+
+func TestClient_do(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	url := "/do-test"
+
+	setupResponder := func(validToken string) *[]string {
+		var received []string
+		httpmock.RegisterResponder("POST", url, func(r *http.Request) (*http.Response, error) {
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			assert.Equal(t, `"body"`, string(body))
+			received = append(received, r.Header.Get("Authorization"))
+			if r.Header.Get("Authorization") != "Bearer "+validToken {
+				return httpmock.NewStringResponse(http.StatusUnauthorized, testProblemJSON), nil
+			}
+			return httpmock.NewStringResponse(http.StatusOK, ""), nil
+		})
+		return &received
+	}
+
+	t.Run("success retry with new token", func(t *testing.T) {
+		received := setupResponder("new-token")
+		var invalidated bool
+		client := &Client{
+			httpClient: http.DefaultClient,
+			tokenProvider: func() (string, error) {
+				return map[bool]string{false: "old-token", true: "new-token"}[invalidated], nil
+			},
+			tokenInvalidator: func() { invalidated = true }}
+
+		request, err := http.NewRequest("POST", url, bytes.NewReader([]byte(`"body"`)))
+		require.NoError(t, err)
+		require.NoError(t, client.authorize(request))
 
+		response, err := client.do(client.httpClient, request)
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, []string{"Bearer old-token", "Bearer new-token"}, *received)
+	})
+
+	t.Run("fail retry only once", func(t *testing.T) {
+		received := setupResponder("valid-token")
+		client := &Client{
+			httpClient:    http.DefaultClient,
+			tokenProvider: func() (string, error) { return "invalid-token", nil }}
+
+		response, err := client.httpPOST(context.Background(), &backoff.StopBackOff{}, url, "body", "error message")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.Len(t, *received, 2)
+	})
+
+	t.Run("no retry without token provider", func(t *testing.T) {
+		received := setupResponder("valid-token")
+		client := &Client{httpClient: http.DefaultClient}
+
+		response, err := client.httpPOST(context.Background(), &backoff.StopBackOff{}, url, "body", "error message")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		assert.Len(t, *received, 1)
 	})
 }
 
@@ -315,7 +417,7 @@ func TestClient_httpPOST(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("POST", url, httpmock.NewStringResponder(200, ""))
 
-		_, err := client.httpPOST(&backoff.StopBackOff{}, url, brokenMarshaler{}, "error message")
+		_, err := client.httpPOST(context.Background(), &backoff.StopBackOff{}, url, brokenMarshaler{}, "error message")
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -325,7 +427,7 @@ func TestClient_httpPOST(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("POST", url, httpmock.NewErrorResponder(assert.AnError))
 
-		_, err := client.httpPOST(&backoff.StopBackOff{}, url, &expected, "error message")
+		_, err := client.httpPOST(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -336,7 +438,7 @@ func TestClient_httpPOST(t *testing.T) {
 		client.tokenProvider = func() (string, error) { return "", assert.AnError }
 		httpmock.RegisterResponder("POST", url, httpmock.NewStringResponder(http.StatusOK, ""))
 
-		_, err := client.httpPOST(&backoff.StopBackOff{}, url, &expected, "error message")
+		_, err := client.httpPOST(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -350,7 +452,7 @@ func TestClient_httpPOST(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPOST(&backoff.StopBackOff{}, url, &expected, "error message")
+		response, err := client.httpPOST(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
@@ -368,7 +470,7 @@ func TestClient_httpPOST(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPOST(&backoff.ZeroBackOff{}, url, &expected, "error message")
+		response, err := client.httpPOST(context.Background(), &backoff.ZeroBackOff{}, url, &expected, "error message")
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
@@ -387,7 +489,7 @@ func TestClient_httpPOST(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPOST(&backoff.ZeroBackOff{}, url, &expected, "error message")
+		response, err := client.httpPOST(context.Background(), &backoff.ZeroBackOff{}, url, &expected, "error message")
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
@@ -404,7 +506,7 @@ func TestClient_httpPOST(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		response, err := client.httpPOST(&backoff.StopBackOff{}, url, &expected, "error message")
+		response, err := client.httpPOST(context.Background(), &backoff.StopBackOff{}, url, &expected, "error message")
 
 		require.NoError(t, err)
 		assert.Equal(t, http.StatusOK, response.StatusCode)
@@ -428,7 +530,7 @@ func TestClient_httpDELETE(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("DELETE", url, httpmock.NewErrorResponder(assert.AnError))
 
-		err := client.httpDELETE(&backoff.StopBackOff{}, url, msg)
+		err := client.httpDELETE(context.Background(), &backoff.StopBackOff{}, url, msg)
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -440,7 +542,7 @@ func TestClient_httpDELETE(t *testing.T) {
 		client.tokenProvider = func() (string, error) { return "", assert.AnError }
 		httpmock.RegisterResponder("DELETE", url, httpmock.NewStringResponder(http.StatusOK, ""))
 
-		err := client.httpDELETE(&backoff.StopBackOff{}, url, msg)
+		err := client.httpDELETE(context.Background(), &backoff.StopBackOff{}, url, msg)
 
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
@@ -454,7 +556,7 @@ func TestClient_httpDELETE(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		err := client.httpDELETE(&backoff.StopBackOff{}, url, msg)
+		err := client.httpDELETE(context.Background(), &backoff.StopBackOff{}, url, msg)
 
 		assert.NoError(t, err)
 	})
@@ -469,7 +571,7 @@ func TestClient_httpDELETE(t *testing.T) {
 		})
 		httpmock.RegisterResponder("DELETE", url, responder)
 
-		err := client.httpDELETE(&backoff.StopBackOff{}, url, msg)
+		err := client.httpDELETE(context.Background(), &backoff.StopBackOff{}, url, msg)
 
 		require.Error(t, err)
 		assert.Regexp(t, "unable to read response body", err)
@@ -487,7 +589,7 @@ func TestClient_httpDELETE(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		err := client.httpDELETE(&backoff.ZeroBackOff{}, url, msg)
+		err := client.httpDELETE(context.Background(), &backoff.ZeroBackOff{}, url, msg)
 
 		require.NoError(t, err)
 		assert.Equal(t, 5, <-counter)
@@ -505,7 +607,7 @@ func TestClient_httpDELETE(t *testing.T) {
 			return httpmock.NewStringResponse(http.StatusOK, ""), nil
 		})
 
-		err := client.httpDELETE(&backoff.ZeroBackOff{}, url, msg)
+		err := client.httpDELETE(context.Background(), &backoff.ZeroBackOff{}, url, msg)
 
 		require.NoError(t, err)
 		assert.Equal(t, 5, <-counter)
@@ -515,7 +617,7 @@ func TestClient_httpDELETE(t *testing.T) {
 		client := setupClient(nil)
 		httpmock.RegisterResponder("DELETE", url, httpmock.NewStringResponder(http.StatusOK, ""))
 
-		err := client.httpDELETE(&backoff.StopBackOff{}, url, msg)
+		err := client.httpDELETE(context.Background(), &backoff.StopBackOff{}, url, msg)
 
 		assert.NoError(t, err)
 	})
@@ -0,0 +1,269 @@
+package nakadi
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// partitionSyncInterval is the interval in which the assignment of a stream is synchronized with the
+// subscription stats. Since no batches are received for partitions which were revoked from a stream,
+// revocations can only be detected this way.
+const partitionSyncInterval = 30 * time.Second
+
+// partitionTracker keeps track of the partitions assigned to a stream. Partitions are derived from the
+// cursors seen on the stream and from the stream IDs reported in the subscription stats. Changes of the
+// assignment are passed to the respective callbacks. The stats are retrieved by a background routine
+// which runs as long as a stream is observed, in order not to delay reading batches from the stream.
+//
+// Changes are queued while the tracker is locked and passed to the callbacks after the lock was released,
+// so that callbacks may call back into the stream. The queue is processed by one goroutine at a time in
+// the order of the changes.
+type partitionTracker struct {
+	sync.Mutex
+	subscriptionID string
+	statsAPI       statsAPI
+	onAssigned     func([]StreamPartition)
+	onRevoked      func([]StreamPartition)
+	logger         *slog.Logger
+	interval       time.Duration
+	streamID       string
+	assigned       map[StreamPartition]struct{}
+	seen           map[StreamPartition]struct{}
+	missing        map[StreamPartition]struct{}
+	changes        []partitionChange
+	dispatching    bool
+	syncCh         chan struct{}
+	stop           context.CancelFunc
+}
+
+// partitionChange is a change of the assignment which was not yet passed to the callbacks.
+type partitionChange struct {
+	streamID   string
+	partitions []StreamPartition
+	revoked    bool
+}
+
+// newPartitionTracker creates a partition tracker. It returns nil if neither of the callbacks is set.
+func newPartitionTracker(subscriptionID string, statsAPI statsAPI, onAssigned, onRevoked func([]StreamPartition),
+	logger *slog.Logger) *partitionTracker {
+	if onAssigned == nil && onRevoked == nil {
+		return nil
+	}
+	if onAssigned == nil {
+		onAssigned = func([]StreamPartition) {}
+	}
+	if onRevoked == nil {
+		onRevoked = func([]StreamPartition) {}
+	}
+	return &partitionTracker{
+		subscriptionID: subscriptionID,
+		statsAPI:       statsAPI,
+		onAssigned:     onAssigned,
+		onRevoked:      onRevoked,
+		logger:         logger,
+		interval:       partitionSyncInterval,
+		assigned:       make(map[StreamPartition]struct{}),
+		seen:           make(map[StreamPartition]struct{}),
+		missing:        make(map[StreamPartition]struct{}),
+		syncCh:         make(chan struct{}, 1)}
+}
+
+// observe updates the assignment with the cursor of a batch read from the stream. A partition which is not
+// known yet is assigned right away. If the cursor belongs to a new stream or to a partition which is not
+// known yet, a synchronization with the subscription stats is requested.
+func (t *partitionTracker) observe(cursor Cursor) {
+	if t == nil {
+		return
+	}
+	if cursor.NakadiStreamID != t.currentStreamID() {
+		t.reset()
+		t.start(cursor.NakadiStreamID)
+	}
+
+	partition := StreamPartition{EventType: cursor.EventType, Partition: cursor.Partition}
+	t.Lock()
+	t.seen[partition] = struct{}{}
+	delete(t.missing, partition)
+	_, known := t.assigned[partition]
+	if !known {
+		t.assigned[partition] = struct{}{}
+		t.queue(false, []StreamPartition{partition})
+	}
+	t.Unlock()
+	t.dispatch()
+
+	if !known {
+		select {
+		case t.syncCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// reset revokes all assigned partitions and stops the synchronization of the current stream. It is used
+// when the stream ends.
+func (t *partitionTracker) reset() {
+	if t == nil {
+		return
+	}
+	t.Lock()
+	if t.stop != nil {
+		t.stop()
+		t.stop = nil
+	}
+	t.queue(true, partitionDiff(t.assigned, nil))
+	t.streamID = ""
+	t.assigned = make(map[StreamPartition]struct{})
+	t.seen = make(map[StreamPartition]struct{})
+	t.missing = make(map[StreamPartition]struct{})
+	t.Unlock()
+	t.dispatch()
+}
+
+// queue adds a change of the assignment of the current stream to the changes which are passed to the
+// callbacks by dispatch. The tracker must be locked.
+func (t *partitionTracker) queue(revoked bool, partitions []StreamPartition) {
+	if len(partitions) > 0 {
+		t.changes = append(t.changes, partitionChange{streamID: t.streamID, partitions: partitions, revoked: revoked})
+	}
+}
+
+// dispatch passes the queued changes to the callbacks. If another goroutine is already dispatching, it
+// also passes the changes queued by this goroutine and dispatch returns right away. The tracker must not
+// be locked.
+func (t *partitionTracker) dispatch() {
+	t.Lock()
+	if t.dispatching {
+		t.Unlock()
+		return
+	}
+	t.dispatching = true
+	for len(t.changes) > 0 {
+		change := t.changes[0]
+		t.changes = t.changes[1:]
+		t.Unlock()
+
+		if change.revoked {
+			t.logger.Info("partitions revoked", "stream_id", change.streamID, "partitions", change.partitions)
+			t.onRevoked(change.partitions)
+		} else {
+			t.logger.Info("partitions assigned", "stream_id", change.streamID, "partitions", change.partitions)
+			t.onAssigned(change.partitions)
+		}
+
+		t.Lock()
+	}
+	t.dispatching = false
+	t.Unlock()
+}
+
+func (t *partitionTracker) currentStreamID() string {
+	t.Lock()
+	defer t.Unlock()
+	return t.streamID
+}
+
+// start begins to track a new stream and starts the background routine which synchronizes the assignment
+// of the stream. Without stats, the assignment is only derived from the cursors seen on the stream.
+func (t *partitionTracker) start(streamID string) {
+	t.Lock()
+	defer t.Unlock()
+	t.streamID = streamID
+	if t.statsAPI == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.stop = cancel
+	go t.run(ctx, streamID)
+}
+
+func (t *partitionTracker) run(ctx context.Context, streamID string) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.syncCh:
+			t.sync(streamID)
+		case <-ticker.C:
+			t.sync(streamID)
+		}
+	}
+}
+
+// sync retrieves the partitions assigned to a stream from the subscription stats and reports the
+// differences to the previous assignment. Partitions seen on the stream while the stats were retrieved
+// are always considered as assigned. Since the stats may lag behind the stream, an assigned partition is
+// only revoked if it is missing from the stats of two consecutive syncs and no batch of the partition was
+// seen in between. If the stats are not available or the stream ended meanwhile, the assignment remains
+// unchanged.
+func (t *partitionTracker) sync(streamID string) {
+	t.Lock()
+	t.seen = make(map[StreamPartition]struct{})
+	t.Unlock()
+
+	stats, err := t.statsAPI.GetStats(t.subscriptionID)
+	if err != nil {
+		t.logger.Debug("unable to get stats for subscription", "stream_id", streamID, "error", err)
+		return
+	}
+
+	t.Lock()
+	defer t.dispatch()
+	defer t.Unlock()
+	if t.streamID != streamID {
+		return
+	}
+
+	current := make(map[StreamPartition]struct{}, len(t.seen))
+	for partition := range t.seen {
+		current[partition] = struct{}{}
+	}
+	for _, stat := range stats {
+		for _, partition := range stat.Partitions {
+			if partition.StreamID == streamID {
+				current[StreamPartition{EventType: stat.EventType, Partition: partition.Partition}] = struct{}{}
+			}
+		}
+	}
+
+	var revoked []StreamPartition
+	missing := make(map[StreamPartition]struct{})
+	for _, partition := range partitionDiff(t.assigned, current) {
+		if _, ok := t.missing[partition]; ok {
+			revoked = append(revoked, partition)
+		} else {
+			missing[partition] = struct{}{}
+			current[partition] = struct{}{}
+		}
+	}
+	assigned := partitionDiff(current, t.assigned)
+	t.assigned = current
+	t.missing = missing
+
+	t.queue(true, revoked)
+	t.queue(false, assigned)
+}
+
+// partitionDiff returns all partitions of a which are not contained in b ordered by event type and
+// partition.
+func partitionDiff(a, b map[StreamPartition]struct{}) []StreamPartition {
+	var diff []StreamPartition
+	for partition := range a {
+		if _, ok := b[partition]; !ok {
+			diff = append(diff, partition)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		if diff[i].EventType != diff[j].EventType {
+			return diff[i].EventType < diff[j].EventType
+		}
+		return diff[i].Partition < diff[j].Partition
+	})
+	return diff
+}
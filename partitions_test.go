@@ -0,0 +1,251 @@
+package nakadi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPartitionTracker(t *testing.T) {
+	assert.Nil(t, newPartitionTracker("sub-id", nil, nil, nil, discardLogger))
+
+	tracker := newPartitionTracker("sub-id", nil, func([]StreamPartition) {}, nil, discardLogger)
+	require.NotNil(t, tracker)
+	assert.NotPanics(t, func() { tracker.onRevoked(nil) })
+
+	var nilTracker *partitionTracker
+	assert.NotPanics(t, func() {
+		nilTracker.observe(Cursor{})
+		nilTracker.reset()
+	})
+}
+
+func TestPartitionTracker(t *testing.T) {
+	var assigned, revoked [][]StreamPartition
+	setupTracker := func(statsAPI statsAPI) *partitionTracker {
+		assigned, revoked = nil, nil
+		return newPartitionTracker("sub-id", statsAPI,
+			func(partitions []StreamPartition) { assigned = append(assigned, partitions) },
+			func(partitions []StreamPartition) { revoked = append(revoked, partitions) },
+			discardLogger)
+	}
+	stats := func(streamIDs ...string) []*SubscriptionStats {
+		stat := &SubscriptionStats{EventType: "test"}
+		for i, streamID := range streamIDs {
+			stat.Partitions = append(stat.Partitions, &PartitionStats{Partition: string(rune('0' + i)), StreamID: streamID})
+		}
+		return []*SubscriptionStats{stat}
+	}
+	partitions := func(ps ...string) []StreamPartition {
+		var result []StreamPartition
+		for _, p := range ps {
+			result = append(result, StreamPartition{EventType: "test", Partition: p})
+		}
+		return result
+	}
+
+	t.Run("assign partitions seen on the stream", func(t *testing.T) {
+		tracker := setupTracker(nil)
+
+		tracker.observe(Cursor{EventType: "test", Partition: "0", NakadiStreamID: "stream-a"})
+		tracker.observe(Cursor{EventType: "test", Partition: "1", NakadiStreamID: "stream-a"})
+		tracker.observe(Cursor{EventType: "test", Partition: "0", NakadiStreamID: "stream-a"})
+		tracker.observe(Cursor{EventType: "test", Partition: "1", NakadiStreamID: "stream-b"})
+		tracker.reset()
+
+		assert.Equal(t, [][]StreamPartition{partitions("0"), partitions("1"), partitions("1")}, assigned)
+		assert.Equal(t, [][]StreamPartition{partitions("0", "1"), partitions("1")}, revoked)
+	})
+
+	t.Run("assign partitions from stats", func(t *testing.T) {
+		statsAPI := &mockStatsAPI{}
+		statsAPI.On("GetStats", "sub-id").Return(stats("stream-a", "stream-b", "stream-a"), nil).Once()
+		tracker := setupTracker(statsAPI)
+		tracker.streamID = "stream-a"
+
+		tracker.sync("stream-a")
+
+		assert.Equal(t, [][]StreamPartition{partitions("0", "2")}, assigned)
+		assert.Empty(t, revoked)
+		statsAPI.AssertExpectations(t)
+	})
+
+	t.Run("rebalance", func(t *testing.T) {
+		statsAPI := &mockStatsAPI{}
+		statsAPI.On("GetStats", "sub-id").Return(stats("stream-a", "stream-a"), nil).Once()
+		statsAPI.On("GetStats", "sub-id").Return(stats("stream-b", "stream-a", "stream-a"), nil).Twice()
+		tracker := setupTracker(statsAPI)
+		tracker.streamID = "stream-a"
+
+		tracker.sync("stream-a")
+		tracker.sync("stream-a")
+
+		assert.Equal(t, [][]StreamPartition{partitions("0", "1"), partitions("2")}, assigned)
+		assert.Empty(t, revoked)
+
+		tracker.sync("stream-a")
+
+		assert.Equal(t, [][]StreamPartition{partitions("0")}, revoked)
+		statsAPI.AssertExpectations(t)
+	})
+
+	t.Run("keep partitions seen between stale stats", func(t *testing.T) {
+		statsAPI := &mockStatsAPI{}
+		statsAPI.On("GetStats", "sub-id").Return(stats(), nil)
+		tracker := setupTracker(statsAPI)
+		tracker.streamID = "stream-a"
+		tracker.assigned[StreamPartition{EventType: "test", Partition: "0"}] = struct{}{}
+
+		tracker.sync("stream-a")
+		tracker.observe(Cursor{EventType: "test", Partition: "0", NakadiStreamID: "stream-a"})
+		tracker.sync("stream-a")
+
+		assert.Empty(t, revoked)
+
+		tracker.sync("stream-a")
+
+		assert.Empty(t, assigned)
+		assert.Equal(t, [][]StreamPartition{partitions("0")}, revoked)
+	})
+
+	t.Run("call back into the tracker", func(t *testing.T) {
+		var streamIDs []string
+		var tracker *partitionTracker
+		tracker = newPartitionTracker("sub-id", nil,
+			func([]StreamPartition) { streamIDs = append(streamIDs, tracker.currentStreamID()) },
+			func([]StreamPartition) { streamIDs = append(streamIDs, tracker.currentStreamID()) },
+			discardLogger)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			tracker.observe(Cursor{EventType: "test", Partition: "0", NakadiStreamID: "stream-a"})
+			tracker.reset()
+		}()
+
+		select {
+		case <-done:
+			assert.Equal(t, []string{"stream-a", ""}, streamIDs)
+		case <-time.After(time.Second):
+			assert.Fail(t, "callbacks are blocked by the tracker")
+		}
+	})
+
+	t.Run("keep partitions seen during sync", func(t *testing.T) {
+		statsAPI := &mockStatsAPI{}
+		tracker := setupTracker(statsAPI)
+		tracker.streamID = "stream-a"
+		tracker.assigned[StreamPartition{EventType: "test", Partition: "1"}] = struct{}{}
+		statsAPI.On("GetStats", "sub-id").Return(stats("stream-a"), nil).Once().Run(func(mock.Arguments) {
+			tracker.seen[StreamPartition{EventType: "test", Partition: "1"}] = struct{}{}
+		})
+
+		tracker.sync("stream-a")
+
+		assert.Equal(t, [][]StreamPartition{partitions("0")}, assigned)
+		assert.Empty(t, revoked)
+	})
+
+	t.Run("ignore stats of ended stream", func(t *testing.T) {
+		statsAPI := &mockStatsAPI{}
+		statsAPI.On("GetStats", "sub-id").Return(stats("stream-a"), nil).Once()
+		tracker := setupTracker(statsAPI)
+		tracker.streamID = "stream-b"
+
+		tracker.sync("stream-a")
+
+		assert.Empty(t, assigned)
+		assert.Empty(t, revoked)
+	})
+
+	t.Run("stats not available", func(t *testing.T) {
+		statsAPI := &mockStatsAPI{}
+		statsAPI.On("GetStats", "sub-id").Return(nil, assert.AnError).Once()
+		tracker := setupTracker(statsAPI)
+		tracker.streamID = "stream-a"
+		tracker.assigned[StreamPartition{EventType: "test", Partition: "0"}] = struct{}{}
+
+		tracker.sync("stream-a")
+
+		assert.Empty(t, assigned)
+		assert.Empty(t, revoked)
+		assert.Len(t, tracker.assigned, 1)
+	})
+}
+
+func TestPartitionTracker_background(t *testing.T) {
+	assignedCh := make(chan []StreamPartition, 10)
+	revokedCh := make(chan []StreamPartition, 10)
+	statsAPI := &mockStatsAPI{}
+	statsAPI.On("GetStats", "sub-id").Return([]*SubscriptionStats{{EventType: "test", Partitions: []*PartitionStats{
+		{Partition: "0", StreamID: "stream-a"}, {Partition: "1", StreamID: "stream-a"}}}}, nil).Once()
+	statsAPI.On("GetStats", "sub-id").Return([]*SubscriptionStats{{EventType: "test", Partitions: []*PartitionStats{
+		{Partition: "0", StreamID: "stream-b"}, {Partition: "1", StreamID: "stream-a"}}}}, nil)
+	tracker := newPartitionTracker("sub-id", statsAPI,
+		func(partitions []StreamPartition) { assignedCh <- partitions },
+		func(partitions []StreamPartition) { revokedCh <- partitions },
+		discardLogger)
+	tracker.interval = 10 * time.Millisecond
+	defer tracker.reset()
+
+	receive := func(ch chan []StreamPartition) []StreamPartition {
+		select {
+		case partitions := <-ch:
+			return partitions
+		case <-time.After(time.Second):
+			assert.Fail(t, "no partitions received")
+			return nil
+		}
+	}
+
+	tracker.observe(Cursor{EventType: "test", Partition: "0", NakadiStreamID: "stream-a"})
+
+	assert.Equal(t, []StreamPartition{{EventType: "test", Partition: "0"}}, receive(assignedCh))
+	assert.Equal(t, []StreamPartition{{EventType: "test", Partition: "1"}}, receive(assignedCh))
+	assert.Equal(t, []StreamPartition{{EventType: "test", Partition: "0"}}, receive(revokedCh))
+}
+
+func TestStreamAPI_partitionCallbacks(t *testing.T) {
+	blockCh := make(chan time.Time, 1)
+	stream := &mockStreamer{}
+	streamAPI, opener, _ := setupMockStream(nil, nil)
+	defer streamAPI.Close()
+
+	cursor := Cursor{EventType: "test", Partition: "0", NakadiStreamID: "stream-a"}
+	opener.On("openStream").Return(stream, nil).WaitUntil(blockCh).Once()
+	opener.On("openStream").Return(nil, assert.AnError)
+	stream.On("nextEvents").Return(cursor, []byte(`[{}]`), nil).Once()
+	stream.On("nextEvents").Return(Cursor{}, nil, assert.AnError).Once()
+	stream.On("nextEvents").Return(Cursor{}, []byte{}, nil)
+	stream.On("closeStream").Return(nil)
+
+	assignedCh := make(chan []StreamPartition, 10)
+	revokedCh := make(chan []StreamPartition, 10)
+	streamAPI.partitions = newPartitionTracker("sub-id", nil,
+		func(partitions []StreamPartition) { assignedCh <- partitions },
+		func(partitions []StreamPartition) { revokedCh <- partitions },
+		discardLogger)
+	blockCh <- time.Now()
+
+	select {
+	case partitions := <-assignedCh:
+		assert.Equal(t, []StreamPartition{{EventType: "test", Partition: "0"}}, partitions)
+	case <-time.After(time.Second):
+		assert.Fail(t, "partitions were not assigned")
+	}
+
+	_, _, err := streamAPI.NextEvents()
+	require.NoError(t, err)
+	_, _, err = streamAPI.NextEvents()
+	require.Error(t, err)
+
+	select {
+	case partitions := <-revokedCh:
+		assert.Equal(t, []StreamPartition{{EventType: "test", Partition: "0"}}, partitions)
+	case <-time.After(time.Second):
+		assert.Fail(t, "partitions were not revoked")
+	}
+}
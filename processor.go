@@ -2,11 +2,14 @@ package nakadi
 
 import (
 	"context"
+	"log/slog"
 	"math/rand"
 	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.31.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ProcessorOptions contains optional parameters that are used to create a Processor.
@@ -26,6 +29,28 @@ type ProcessorOptions struct {
 	// state and commit comes - the stream will resume. If MaxUncommittedEvents is lower than BatchLimit,
 	// effective batch size will be upperbound by MaxUncommittedEvents. (default: 10, minimum: 1)
 	MaxUncommittedEvents uint
+	// The maximum number of events in a stream. Once the limit was reached, Nakadi closes the stream and
+	// a new stream is opened. 0 means that the number of events is unlimited (default: 0)
+	StreamLimit uint
+	// Maximum time in seconds a stream lives before Nakadi closes it. Once the stream was closed, a new
+	// stream is opened. 0 means that the stream is not closed (default: 0)
+	StreamTimeout uint
+	// The maximum number of empty keep alive batches Nakadi sends in a row before the stream is closed.
+	// 0 means that the number of keep alive batches is unlimited (default: 0)
+	StreamKeepAliveLimit uint
+	// Maximum time in seconds Nakadi waits for the commit of a batch before the stream is closed. 0 means
+	// that Nakadi's default applies (default: 60)
+	CommitTimeout uint
+	// Time span in seconds which the received_at timestamps of the events in a batch may cover. Batches
+	// are flushed once the time span was reached. 0 means that batches are not limited by a time span
+	// (default: 0)
+	BatchTimespan uint
+	// The maximum size of a single batch in bytes. If a batch exceeds this size, reading the batch fails
+	// with a BatchTooLargeError. Since Nakadi would send the same batch again, the stream doesn't reconnect
+	// but stops in the state StreamFailed and the error is passed to NotifyErr. The stream has to be
+	// closed and MaxBatchSize or BatchLimit adjusted in order to continue. This protects against unbounded
+	// memory growth caused by pathological batches. 0 means that the size is unlimited (default: 0)
+	MaxBatchSize uint
 	// The initial (minimal) retry interval used for the exponential backoff. This value is applied for
 	// stream initialization as well as for cursor commits.
 	InitialRetryInterval time.Duration
@@ -38,11 +63,31 @@ type ProcessorOptions struct {
 	CommitMaxElapsedTime time.Duration
 	// NotifyErr is called when an error occurs that leads to a retry. This notifier function can be used to
 	// detect unhealthy streams. The first parameter indicates the stream No that encountered the error.
+	// If a stream stops because of an error which can't be resolved by retrying, such as a
+	// BatchTooLargeError, NotifyErr is called with a duration of 0.
 	NotifyErr func(uint, error, time.Duration)
 	// NotifyOK is called whenever a successful operation was completed. This notifier function can be used
 	// to detect that a stream is healthy again. The first parameter indicates the stream No that just
 	// regained health.
 	NotifyOK func(uint)
+	// OnPartitionsAssigned is called when partitions were assigned to one of the streams. The first
+	// parameter indicates the stream No the partitions were assigned to. See StreamOptions for details.
+	OnPartitionsAssigned func(uint, []StreamPartition)
+	// OnPartitionsRevoked is called when partitions were revoked from one of the streams. The first
+	// parameter indicates the stream No the partitions were revoked from. See StreamOptions for details.
+	OnPartitionsRevoked func(uint, []StreamPartition)
+	// OnControl is called for each batch without events and for each batch which carries an info object.
+	// The first parameter indicates the stream No that received the batch. See StreamOptions for details.
+	OnControl func(uint, ControlMessage)
+	// Tracer is used to start a consumer span for each processed batch. The span is linked to the spans
+	// of the producers of the events and has child spans for the operation and the commit. The span of
+	// the operation is passed to operations started with StartContext. Furthermore the tracer is used by
+	// the underlying streams to record receive spans. If no tracer is set, no spans are created.
+	Tracer trace.Tracer
+	// RetryPolicy configures retries in more detail. If set, the policy is applied to stream
+	// initialization as well as to cursor commits and takes precedence over InitialRetryInterval,
+	// MaxRetryInterval and CommitMaxElapsedTime.
+	RetryPolicy *RetryPolicy
 }
 
 func (o *ProcessorOptions) withDefaults() *ProcessorOptions {
@@ -80,14 +125,24 @@ func (o *ProcessorOptions) withDefaults() *ProcessorOptions {
 	if copyOptions.MaxUncommittedEvents == 0 {
 		copyOptions.MaxUncommittedEvents = 10
 	}
+	if copyOptions.RetryPolicy != nil {
+		copyOptions.RetryPolicy = copyOptions.RetryPolicy.withDefaults()
+	}
 	return &copyOptions
 }
 
 // streamAPI is a contract that is used internally in order to be able to mock StreamAPI
+// tracedStreamAPI is implemented by streams which provide the producer links of each batch, which were
+// extracted when recording the receive span of the batch.
+type tracedStreamAPI interface {
+	nextTracedEvents(ctx context.Context) (Cursor, []byte, *batchTrace, error)
+}
+
 type streamAPI interface {
-	NextEvents() (Cursor, []byte, error)
+	NextEventsContext(ctx context.Context) (Cursor, []byte, error)
 	CommitCursor(cursor Cursor) error
 	Close() error
+	Status() StreamStatus
 }
 
 // NewProcessor creates a new processor for a given subscription ID.  The constructor receives a
@@ -112,6 +167,8 @@ func NewProcessor(client *Client, subscriptionID string, options *ProcessorOptio
 			return NewStream(client, id, options)
 		},
 		timePerBatchPerStream: time.Duration(timePerBatchPerStream),
+		tracer:                options.Tracer,
+		logger:                client.log().With("subscription_id", subscriptionID),
 		closeErrorCh:          make(chan error)}
 
 	for i := uint(0); i < options.StreamCount; i++ {
@@ -120,11 +177,32 @@ func NewProcessor(client *Client, subscriptionID string, options *ProcessorOptio
 			BatchLimit:           options.BatchLimit,
 			FlushTimeout:         options.FlushTimeout,
 			MaxUncommittedEvents: options.MaxUncommittedEvents,
+			StreamLimit:          options.StreamLimit,
+			StreamTimeout:        options.StreamTimeout,
+			StreamKeepAliveLimit: options.StreamKeepAliveLimit,
+			CommitTimeout:        options.CommitTimeout,
+			BatchTimespan:        options.BatchTimespan,
+			MaxBatchSize:         options.MaxBatchSize,
 			InitialRetryInterval: options.InitialRetryInterval,
 			MaxRetryInterval:     options.MaxRetryInterval,
 			CommitMaxElapsedTime: options.CommitMaxElapsedTime,
+			RetryPolicy:          options.RetryPolicy,
 			NotifyErr:            func(err error, duration time.Duration) { options.NotifyErr(streamNo, err, duration) },
 			NotifyOK:             func() { options.NotifyOK(streamNo) },
+			Tracer:               options.Tracer,
+		}
+		if options.OnPartitionsAssigned != nil {
+			streamOptions.OnPartitionsAssigned = func(partitions []StreamPartition) {
+				options.OnPartitionsAssigned(streamNo, partitions)
+			}
+		}
+		if options.OnPartitionsRevoked != nil {
+			streamOptions.OnPartitionsRevoked = func(partitions []StreamPartition) {
+				options.OnPartitionsRevoked(streamNo, partitions)
+			}
+		}
+		if options.OnControl != nil {
+			streamOptions.OnControl = func(message ControlMessage) { options.OnControl(streamNo, message) }
 		}
 		processor.streamOptions = append(processor.streamOptions, streamOptions)
 	}
@@ -143,10 +221,15 @@ type Processor struct {
 	streamOptions         []StreamOptions
 	newStream             func(*Client, string, *StreamOptions) streamAPI
 	timePerBatchPerStream time.Duration
+	tracer                trace.Tracer
+	logger                *slog.Logger
 	isStarted             bool
 	ctx                   context.Context
 	cancel                context.CancelFunc
 	closeErrorCh          chan error
+	streamsMutex          sync.Mutex
+	streams               []streamAPI
+	running               bool
 }
 
 // Operation defines a certain procedure that consumes the event data from a processor. An operation,
@@ -155,6 +238,10 @@ type Processor struct {
 // encoded event payload.
 type Operation func(int, string, []byte) error
 
+// ContextOperation is like Operation but receives a context as first parameter. If the processor is
+// configured with a tracer, the context carries the consumer span of the processed batch.
+type ContextOperation func(context.Context, int, string, []byte) error
+
 // Start begins event processing. All event batches received from the underlying streams are passed to
 // the operation function. If the operation function terminates without error the respective cursor will
 // be automatically committed to Nakadi. If the operations terminate with an error, the underlying stream
@@ -163,6 +250,14 @@ type Operation func(int, string, []byte) error
 // Event processing will go on indefinitely unless the processor is stopped via its Stop method. Star will
 // return an error if the processor is already running.
 func (p *Processor) Start(operation Operation) error {
+	return p.StartContext(func(_ context.Context, streamNo int, streamID string, events []byte) error {
+		return operation(streamNo, streamID, events)
+	})
+}
+
+// StartContext works like Start, but passes a context to the operation function. The context is canceled
+// when the processor is stopped.
+func (p *Processor) StartContext(operation ContextOperation) error {
 	p.Lock()
 	defer p.Unlock()
 
@@ -170,6 +265,7 @@ func (p *Processor) Start(operation Operation) error {
 		return errors.New("processor was already started")
 	}
 	p.isStarted = true
+	p.setRunning(true)
 
 	for streamNo, options := range p.streamOptions {
 		go p.startSingleStream(operation, streamNo, options)
@@ -180,8 +276,9 @@ func (p *Processor) Start(operation Operation) error {
 
 // startSingleStream starts a single stream with a given stream number / position. After the stream has been
 // started it consumes events. In cases of errors the stream is closed and a new stream will be opened.
-func (p *Processor) startSingleStream(operation Operation, streamNo int, options StreamOptions) {
+func (p *Processor) startSingleStream(operation ContextOperation, streamNo int, options StreamOptions) {
 	stream := p.newStream(p.client, p.subscriptionID, &options)
+	p.setStream(streamNo, stream)
 
 	if p.timePerBatchPerStream > 0 {
 		initialWait := rand.Int63n(int64(p.timePerBatchPerStream))
@@ -202,24 +299,19 @@ func (p *Processor) startSingleStream(operation Operation, streamNo int, options
 			p.closeErrorCh <- stream.Close()
 			return
 		default:
-			cursor, events, err := stream.NextEvents()
+			cursor, events, traced, err := nextBatch(p.ctx, stream)
 			if err != nil {
 				continue
 			}
 
-			err = operation(streamNo, cursor.NakadiStreamID, events)
-			if err != nil {
-				options.NotifyErr(err, 0)
-				_ = stream.Close()
-				stream = p.newStream(p.client, p.subscriptionID, &options)
-				continue
-			}
-
-			err = stream.CommitCursor(cursor)
+			err = p.process(operation, stream, streamNo, cursor, events, traced)
 			if err != nil {
+				p.logger.Warn("unable to process batch, restarting stream",
+					append(cursorLogAttrs(cursor), "stream_no", streamNo, "error", err)...)
 				options.NotifyErr(err, 0)
 				_ = stream.Close()
 				stream = p.newStream(p.client, p.subscriptionID, &options)
+				p.setStream(streamNo, stream)
 				continue
 			}
 		}
@@ -237,6 +329,85 @@ func (p *Processor) startSingleStream(operation Operation, streamNo int, options
 	}
 }
 
+// Status returns the current status of the processor and all of its streams. Streams which were not
+// created yet are reported as connecting.
+func (p *Processor) Status() ProcessorStatus {
+	p.streamsMutex.Lock()
+	defer p.streamsMutex.Unlock()
+
+	status := ProcessorStatus{Started: p.running, Streams: make([]StreamStatus, len(p.streamOptions))}
+	for i := range status.Streams {
+		if i < len(p.streams) && p.streams[i] != nil {
+			status.Streams[i] = p.streams[i].Status()
+		} else if !p.running {
+			status.Streams[i] = StreamStatus{State: StreamClosed}
+		}
+	}
+	return status
+}
+
+func (p *Processor) setRunning(running bool) {
+	p.streamsMutex.Lock()
+	defer p.streamsMutex.Unlock()
+	p.running = running
+}
+
+func (p *Processor) setStream(streamNo int, stream streamAPI) {
+	p.streamsMutex.Lock()
+	defer p.streamsMutex.Unlock()
+	if p.streams == nil {
+		p.streams = make([]streamAPI, len(p.streamOptions))
+	}
+	p.streams[streamNo] = stream
+}
+
+// nextBatch reads the next batch of events from a stream and stops waiting once ctx is done. If the stream
+// provides the producer links of the batch, which were extracted for its receive span, they are returned
+// as well.
+func nextBatch(ctx context.Context, stream streamAPI) (Cursor, []byte, *batchTrace, error) {
+	if traced, ok := stream.(tracedStreamAPI); ok {
+		return traced.nextTracedEvents(ctx)
+	}
+	cursor, events, err := stream.NextEventsContext(ctx)
+	return cursor, events, nil, err
+}
+
+// process passes a batch of events to the operation and commits the cursor if the operation was successful.
+// If traced is nil, the producer links for the batch span are extracted from the events.
+func (p *Processor) process(operation ContextOperation, stream streamAPI, streamNo int, cursor Cursor, events []byte,
+	traced *batchTrace) error {
+	if p.tracer == nil {
+		err := operation(p.ctx, streamNo, cursor.NakadiStreamID, events)
+		if err != nil {
+			return err
+		}
+		return stream.CommitCursor(cursor)
+	}
+
+	if traced == nil {
+		traced = newBatchTrace(events)
+	}
+	ctx, span := startMessagingSpan(p.ctx, p.tracer, semconv.MessagingOperationTypeProcess, "process", cursor, traced)
+	span.SetAttributes(semconv.MessagingDestinationSubscriptionName(p.subscriptionID))
+
+	opCtx, opSpan := p.tracer.Start(ctx, messagingSpanName("operation", cursor), trace.WithSpanKind(trace.SpanKindInternal))
+	err := operation(opCtx, streamNo, cursor.NakadiStreamID, events)
+	endSpan(opSpan, err)
+	if err != nil {
+		endSpan(span, err)
+		return err
+	}
+
+	_, commitSpan := p.tracer.Start(ctx, messagingSpanName("commit", cursor),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(messagingAttributes(semconv.MessagingOperationTypeSettle, "commit", cursor)...),
+		trace.WithAttributes(semconv.MessagingDestinationSubscriptionName(p.subscriptionID)))
+	err = stream.CommitCursor(cursor)
+	endSpan(commitSpan, err)
+	endSpan(span, err)
+	return err
+}
+
 // Stop halts all steams and terminates event processing. Stop will return with an error if the processor
 // is not running.
 func (p *Processor) Stop() error {
@@ -248,6 +419,7 @@ func (p *Processor) Stop() error {
 	}
 
 	p.cancel()
+	p.setRunning(false)
 
 	var errCount int
 	for i := 0; i < len(p.streamOptions); i++ {
@@ -8,6 +8,10 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -165,7 +169,7 @@ func TestProcessor_Start(t *testing.T) {
 
 		newStream.On("NewStream", testClient, testSubscriptionID).
 			Return(streamAPI)
-		streamAPI.On("NextEvents").
+		streamAPI.On("NextEventsContext").
 			Return(Cursor{}, nil, assert.AnError)
 
 		_ = processor.Start(func(i int, id string, batch []byte) error {
@@ -177,7 +181,7 @@ func TestProcessor_Start(t *testing.T) {
 		newStream.AssertCalled(t, "NewStream", testClient, testSubscriptionID)
 
 		<-streamAPI.wait
-		streamAPI.AssertCalled(t, "NextEvents")
+		streamAPI.AssertCalled(t, "NextEventsContext")
 	})
 
 	t.Run("fail during operation", func(t *testing.T) {
@@ -188,7 +192,7 @@ func TestProcessor_Start(t *testing.T) {
 			Return(streamAPI)
 		streamAPI.On("Close").
 			Return(nil)
-		streamAPI.On("NextEvents").
+		streamAPI.On("NextEventsContext").
 			Return(Cursor{}, []byte("batch no 1"), nil)
 
 		_ = processor.Start(func(i int, id string, batch []byte) error {
@@ -200,7 +204,7 @@ func TestProcessor_Start(t *testing.T) {
 		newStream.AssertCalled(t, "NewStream", testClient, testSubscriptionID)
 
 		<-streamAPI.wait
-		streamAPI.AssertCalled(t, "NextEvents")
+		streamAPI.AssertCalled(t, "NextEventsContext")
 
 		batch := <-batchCh
 		require.Equal(t, []byte("batch no 1"), batch)
@@ -220,7 +224,7 @@ func TestProcessor_Start(t *testing.T) {
 			Return(streamAPI)
 		streamAPI.On("CommitCursor", Cursor{}).
 			Return(nil)
-		streamAPI.On("NextEvents").
+		streamAPI.On("NextEventsContext").
 			Return(Cursor{}, []byte("batch no 1"), nil)
 
 		_ = processor.Start(func(i int, id string, batch []byte) error {
@@ -232,7 +236,7 @@ func TestProcessor_Start(t *testing.T) {
 		newStream.AssertCalled(t, "NewStream", testClient, testSubscriptionID)
 
 		<-streamAPI.wait
-		streamAPI.AssertCalled(t, "NextEvents")
+		streamAPI.AssertCalled(t, "NextEventsContext")
 
 		batch := <-batchCh
 		require.Equal(t, []byte("batch no 1"), batch)
@@ -241,7 +245,7 @@ func TestProcessor_Start(t *testing.T) {
 		streamAPI.AssertCalled(t, "CommitCursor", Cursor{})
 
 		<-streamAPI.wait
-		streamAPI.AssertCalled(t, "NextEvents")
+		streamAPI.AssertCalled(t, "NextEventsContext")
 
 		batch = <-batchCh
 		require.Equal(t, []byte("batch no 1"), batch)
@@ -251,6 +255,87 @@ func TestProcessor_Start(t *testing.T) {
 	})
 }
 
+func TestProcessor_StartContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	spanCh := make(chan oteltrace.SpanContext, 1)
+	newStream, streamAPI, processor := setupMockProcessor()
+	processor.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test-tracer")
+
+	newStream.On("NewStream", testClient, testSubscriptionID).
+		Return(streamAPI)
+	streamAPI.On("CommitCursor", Cursor{}).
+		Return(nil)
+	streamAPI.On("NextEventsContext").
+		Return(Cursor{}, []byte("batch no 1"), nil)
+
+	_ = processor.StartContext(func(ctx context.Context, i int, id string, batch []byte) error {
+		spanCh <- oteltrace.SpanContextFromContext(ctx)
+		return nil
+	})
+
+	<-newStream.wait
+	<-streamAPI.wait
+	spanCtx := <-spanCh
+	assert.True(t, spanCtx.IsValid())
+
+	<-streamAPI.wait
+	streamAPI.AssertCalled(t, "CommitCursor", Cursor{})
+
+	require.Eventually(t, func() bool { return len(exporter.GetSpans()) >= 3 }, time.Second, 10*time.Millisecond)
+	spans := exporter.GetSpans()
+
+	operationSpan, commitSpan, batchSpan := spans[0], spans[1], spans[2]
+	assert.Equal(t, "process", batchSpan.Name)
+	assert.Equal(t, oteltrace.SpanKindConsumer, batchSpan.SpanKind)
+	assert.Contains(t, batchSpan.Attributes, attribute.String("messaging.system", "nakadi"))
+	assert.Contains(t, batchSpan.Attributes, attribute.String("messaging.operation.type", "process"))
+	assert.Contains(t, batchSpan.Attributes, attribute.String("messaging.destination.subscription.name", testSubscriptionID))
+
+	assert.Equal(t, "operation", operationSpan.Name)
+	assert.Equal(t, spanCtx.SpanID(), operationSpan.SpanContext.SpanID())
+	assert.Equal(t, batchSpan.SpanContext.SpanID(), operationSpan.Parent.SpanID())
+
+	assert.Equal(t, "commit", commitSpan.Name)
+	assert.Equal(t, oteltrace.SpanKindClient, commitSpan.SpanKind)
+	assert.Contains(t, commitSpan.Attributes, attribute.String("messaging.operation.type", "settle"))
+	assert.Equal(t, batchSpan.SpanContext.SpanID(), commitSpan.Parent.SpanID())
+}
+
+func TestProcessor_StartContext_tracedStream(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	newStream, streamAPI, processor := setupMockProcessor()
+	processor.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test-tracer")
+
+	producer := oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{0x01},
+		SpanID:     oteltrace.SpanID{0x02},
+		TraceFlags: oteltrace.FlagsSampled})
+	tracedStream := &mockTracedStreamAPI{
+		mockStreamAPI: streamAPI,
+		trace:         &batchTrace{links: []oteltrace.Link{{SpanContext: producer}}, size: 1}}
+
+	newStream.On("NewStream", testClient, testSubscriptionID).
+		Return(tracedStream)
+	streamAPI.On("CommitCursor", Cursor{}).
+		Return(nil)
+
+	_ = processor.StartContext(func(ctx context.Context, i int, id string, batch []byte) error {
+		return nil
+	})
+
+	<-newStream.wait
+	<-streamAPI.wait
+	<-streamAPI.wait
+	streamAPI.AssertNotCalled(t, "NextEventsContext")
+
+	require.Eventually(t, func() bool { return len(exporter.GetSpans()) >= 3 }, time.Second, 10*time.Millisecond)
+	batchSpan := exporter.GetSpans()[2]
+	assert.Equal(t, "process", batchSpan.Name)
+	assert.Contains(t, batchSpan.Attributes, attribute.Int("messaging.batch.message_count", 1))
+	require.Len(t, batchSpan.Links, 1)
+	assert.Equal(t, producer, batchSpan.Links[0].SpanContext)
+}
+
 func TestProcessor_Stop(t *testing.T) {
 	t.Run("fail not running", func(t *testing.T) {
 		_, _, processor := setupMockProcessor()
@@ -265,7 +350,7 @@ func TestProcessor_Stop(t *testing.T) {
 
 		newStream.On("NewStream", testClient, testSubscriptionID).
 			Return(streamAPI)
-		streamAPI.On("NextEvents").
+		streamAPI.On("NextEventsContext").
 			Return(Cursor{}, []byte("batch no 1"), nil)
 		streamAPI.On("CommitCursor", Cursor{}).
 			Return(nil)
@@ -285,12 +370,40 @@ func TestProcessor_Stop(t *testing.T) {
 		streamAPI.AssertCalled(t, "Close")
 	})
 
+	t.Run("success idle stream", func(t *testing.T) {
+		newStream, _, processor := setupMockProcessor()
+		stream := &mockStreamer{}
+		streamAPI, opener, _ := setupMockStream(nil, nil)
+
+		opener.On("openStream").Return(stream, nil)
+		stream.On("nextEvents").Return(Cursor{NakadiStreamID: "stream-id"}, []byte{}, nil).After(10 * time.Millisecond)
+		stream.On("closeStream").Return(nil)
+		newStream.On("NewStream", testClient, testSubscriptionID).
+			Return(streamAPI)
+
+		_ = processor.Start(func(i int, id string, batch []byte) error {
+			return nil
+		})
+		<-newStream.wait
+		time.Sleep(2 * processor.timePerBatchPerStream)
+
+		stopped := make(chan error, 1)
+		go func() { stopped <- processor.Stop() }()
+
+		select {
+		case err := <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("processor did not stop while the stream was idle")
+		}
+	})
+
 	t.Run("success", func(t *testing.T) {
 		newStream, streamAPI, processor := setupMockProcessor()
 
 		newStream.On("NewStream", testClient, testSubscriptionID).
 			Return(streamAPI)
-		streamAPI.On("NextEvents").
+		streamAPI.On("NextEventsContext").
 			Return(Cursor{}, []byte("batch no 1"), nil)
 		streamAPI.On("CommitCursor", Cursor{}).
 			Return(nil)
@@ -325,6 +438,7 @@ func setupMockProcessor() (*mockNewStream, *mockStreamAPI, *Processor) {
 		newStream:             mockNewStream.NewStream,
 		timePerBatchPerStream: 100 * time.Millisecond,
 		streamOptions:         []StreamOptions{*testStreamOptions},
+		logger:                discardLogger,
 		closeErrorCh:          make(chan error)}
 
 	return mockNewStream, mockStreamAPI, processor
@@ -347,7 +461,7 @@ type mockStreamAPI struct {
 	waitClose chan struct{}
 }
 
-func (m *mockStreamAPI) NextEvents() (Cursor, []byte, error) {
+func (m *mockStreamAPI) NextEventsContext(context.Context) (Cursor, []byte, error) {
 	args := m.Called()
 	m.wait <- struct{}{}
 	if args.Error(2) != nil {
@@ -356,12 +470,26 @@ func (m *mockStreamAPI) NextEvents() (Cursor, []byte, error) {
 	return args.Get(0).(Cursor), args.Get(1).([]byte), nil
 }
 
+type mockTracedStreamAPI struct {
+	*mockStreamAPI
+	trace *batchTrace
+}
+
+func (m *mockTracedStreamAPI) nextTracedEvents(context.Context) (Cursor, []byte, *batchTrace, error) {
+	m.wait <- struct{}{}
+	return Cursor{}, []byte("batch no 1"), m.trace, nil
+}
+
 func (m *mockStreamAPI) CommitCursor(cursor Cursor) error {
 	args := m.Called(cursor)
 	m.wait <- struct{}{}
 	return args.Error(0)
 }
 
+func (m *mockStreamAPI) Status() StreamStatus {
+	return StreamStatus{State: StreamStreaming}
+}
+
 func (m *mockStreamAPI) Close() error {
 	args := m.Called()
 	m.waitClose <- struct{}{}
@@ -2,10 +2,12 @@ package nakadi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"strings"
 	"time"
 
@@ -62,6 +64,14 @@ type PublishOptions struct {
 	// this value was reached the exponential backoff is halted and the events will not be
 	// published.
 	MaxElapsedTime time.Duration
+	// RateLimit limits the requests and events published by this PublishAPI. The rate limit applies
+	// in addition to the rate limit of the client. Unlike the rate limit of the client, it is applied
+	// once per call of Publish, regardless of retries. If no rate limit is set, publishing is only
+	// limited by the rate limit of the client.
+	RateLimit *RateLimit
+	// RetryPolicy configures retries in more detail. If set, the policy takes precedence over Retry,
+	// InitialRetryInterval, MaxRetryInterval and MaxElapsedTime.
+	RetryPolicy *RetryPolicy
 }
 
 func (o *PublishOptions) withDefaults() *PublishOptions {
@@ -78,6 +88,9 @@ func (o *PublishOptions) withDefaults() *PublishOptions {
 	if copyOptions.MaxElapsedTime == 0 {
 		copyOptions.MaxElapsedTime = defaultMaxElapsedTime
 	}
+	if copyOptions.RetryPolicy != nil {
+		copyOptions.RetryPolicy = copyOptions.RetryPolicy.withDefaults()
+	}
 	return &copyOptions
 }
 
@@ -91,12 +104,15 @@ func NewPublishAPI(client *Client, eventType string, options *PublishOptions) *P
 
 	return &PublishAPI{
 		client:     client,
+		eventType:  eventType,
 		publishURL: fmt.Sprintf("%s/event-types/%s/events", client.nakadiURL, eventType),
 		backOffConf: backOffConfiguration{
 			Retry:                options.Retry,
 			InitialRetryInterval: options.InitialRetryInterval,
 			MaxRetryInterval:     options.MaxRetryInterval,
-			MaxElapsedTime:       options.MaxElapsedTime}}
+			MaxElapsedTime:       options.MaxElapsedTime,
+			Policy:               options.RetryPolicy},
+		rateLimiter: newRateLimiter(options.RateLimit)}
 }
 
 // PublishAPI is a sub API for publishing Nakadi events. All publish methods emit events as a single batch. If
@@ -104,8 +120,10 @@ func NewPublishAPI(client *Client, eventType string, options *PublishOptions) *P
 // verify which events of a batch have been published.
 type PublishAPI struct {
 	client      *Client
+	eventType   string
 	publishURL  string
 	backOffConf backOffConfiguration
+	rateLimiter *rateLimiter
 }
 
 // PublishDataChangeEvent emits a batch of data change events. Depending on the options used when creating
@@ -126,10 +144,32 @@ func (p *PublishAPI) PublishBusinessEvent(events []BusinessEvent) error {
 // business events. Depending on the options used when creating the PublishAPI this method will retry
 // to publish the events if the were not successfully published.
 func (p *PublishAPI) Publish(events interface{}) error {
+	return p.PublishContext(context.Background(), events)
+}
+
+// PublishContext works like Publish. In addition, if ctx carries a span context, it is propagated to the
+// consumers of the events via the metadata field span_ctx of each event.
+func (p *PublishAPI) PublishContext(ctx context.Context, events interface{}) error {
 	const errMsg = "unable to request event types"
 
-	response, err := p.client.httpPOST(p.backOffConf.create(), p.publishURL, events, errMsg)
+	count := countEvents(events)
+
+	body, err := injectSpanContext(ctx, events)
 	if err != nil {
+		return errors.Wrapf(err, "%s: unable to encode json body", errMsg)
+	}
+
+	if err := p.rateLimiter.wait(ctx, 1, count); err != nil {
+		return errors.Wrap(err, errMsg)
+	}
+	if err := p.client.rateLimiter.wait(ctx, 0, count); err != nil {
+		p.rateLimiter.refund(1, count)
+		return errors.Wrap(err, errMsg)
+	}
+
+	response, err := p.client.httpPOST(ctx, p.backOffConf.create(), p.publishURL, body, errMsg)
+	if err != nil {
+		p.client.metrics.recordPublish(p.eventType, count, count)
 		return err
 	}
 	defer response.Body.Close()
@@ -138,22 +178,36 @@ func (p *PublishAPI) Publish(events interface{}) error {
 		batchItemError := BatchItemsError{}
 		err := json.NewDecoder(response.Body).Decode(&batchItemError)
 		if err != nil {
+			p.client.metrics.recordPublish(p.eventType, count, count)
 			return errors.Wrapf(err, "%s: unable to decode response body", errMsg)
 		}
+		p.client.metrics.recordPublish(p.eventType, count, batchItemError.failed())
 		return batchItemError
 	}
 
 	if response.StatusCode != http.StatusOK {
+		p.client.metrics.recordPublish(p.eventType, count, count)
 		buffer, err := io.ReadAll(response.Body)
 		if err != nil {
 			return errors.Wrapf(err, "%s: unable to read response body", errMsg)
 		}
-		return decodeResponseToError(buffer, "unable to request event types")
+		return withFlowID(decodeResponseToError(buffer, "unable to request event types"), response.Request)
 	}
 
+	p.client.metrics.recordPublish(p.eventType, count, 0)
 	return nil
 }
 
+// countEvents returns the number of events in a batch. Values that are not a slice or array are
+// counted as a single event.
+func countEvents(events interface{}) int {
+	value := reflect.ValueOf(events)
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		return value.Len()
+	}
+	return 1
+}
+
 // BatchItemResponse if a batch is only published partially each batch item response contains information
 // about whether a singe event was successfully published or not.
 type BatchItemResponse struct {
@@ -167,6 +221,17 @@ type BatchItemResponse struct {
 // event in a batch.
 type BatchItemsError []BatchItemResponse
 
+// failed returns the number of batch items which were not submitted.
+func (err BatchItemsError) failed() int {
+	var count int
+	for _, item := range err {
+		if item.PublishingStatus != "submitted" {
+			count++
+		}
+	}
+	return count
+}
+
 // Error implements the error interface for BatchItemsError.
 func (err BatchItemsError) Error() string {
 	if err == nil {
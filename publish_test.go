@@ -1,6 +1,7 @@
 package nakadi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -11,6 +12,9 @@ import (
 	"github.com/jarcoal/httpmock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 type SomeData struct {
@@ -153,6 +157,38 @@ func TestPublishAPI_Publish(t *testing.T) {
 	})
 }
 
+func TestPublishAPI_PublishContext(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test-tracer").Start(context.Background(), "publish")
+	defer span.End()
+
+	events := []SomeUndefinedEvent{}
+	helperLoadTestData(t, "events-undefined-create.json", &events)
+
+	url := fmt.Sprintf("%s/event-types/%s/events", defaultNakadiURL, "test-event.undefined")
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	publishAPI := NewPublishAPI(client, "test-event.undefined", nil)
+
+	httpmock.RegisterResponder("POST", url, func(r *http.Request) (*http.Response, error) {
+		uploaded := []SomeUndefinedEvent{}
+		err := json.NewDecoder(r.Body).Decode(&uploaded)
+		require.NoError(t, err)
+		require.Len(t, uploaded, len(events))
+		for i := range uploaded {
+			assert.Equal(t, span.SpanContext().SpanID(), uploaded[i].Metadata.SpanContext().SpanID())
+			uploaded[i].Metadata.SpanCtx = nil
+		}
+		assert.Equal(t, events, uploaded)
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+
+	err := publishAPI.PublishContext(ctx, events)
+	require.NoError(t, err)
+}
+
 func TestPublishAPI_PublishDataChangeEvent(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
@@ -0,0 +1,171 @@
+package nakadi
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrRateLimitExceeded is returned if a request would exceed a client side rate limit, which is configured
+// to fail fast instead of blocking.
+var ErrRateLimitExceeded = errors.New("client side rate limit exceeded")
+
+// RateLimit configures a client side token bucket rate limiter. A rate limit can be applied to all requests
+// of a client via ClientOptions and to a single PublishAPI via PublishOptions.
+type RateLimit struct {
+	// RequestsPerSecond is the sustained number of requests per second. 0 means that the number of requests
+	// is not limited (default: 0)
+	RequestsPerSecond float64
+	// RequestBurst is the maximum number of requests that can be sent at once (default: RequestsPerSecond
+	// rounded up, at least 1)
+	RequestBurst int
+	// EventsPerSecond is the sustained number of published events per second. 0 means that the number of
+	// events is not limited (default: 0)
+	EventsPerSecond float64
+	// EventBurst is the maximum number of events that can be published at once. A batch with more events is
+	// published once the bucket is full, and subsequent batches are delayed accordingly (default:
+	// EventsPerSecond rounded up, at least 1)
+	EventBurst int
+	// FailFast makes requests that would exceed the limit fail with ErrRateLimitExceeded. Otherwise requests
+	// block until the limit permits them or the context of the request is done (default: false)
+	FailFast bool
+}
+
+// newRateLimiter creates a rate limiter from the given configuration. If the configuration is nil or does
+// not limit anything, newRateLimiter returns nil, which is a valid rate limiter that permits everything.
+func newRateLimiter(limit *RateLimit) *rateLimiter {
+	if limit == nil || (limit.RequestsPerSecond <= 0 && limit.EventsPerSecond <= 0) {
+		return nil
+	}
+
+	now := time.Now()
+	return &rateLimiter{
+		requests: newTokenBucket(limit.RequestsPerSecond, limit.RequestBurst, now),
+		events:   newTokenBucket(limit.EventsPerSecond, limit.EventBurst, now),
+		failFast: limit.FailFast,
+		now:      time.Now}
+}
+
+// rateLimiter limits the number of requests and events using two token buckets. A nil *rateLimiter is
+// valid and permits everything.
+type rateLimiter struct {
+	sync.Mutex
+	requests *tokenBucket
+	events   *tokenBucket
+	failFast bool
+	now      func() time.Time
+}
+
+// wait takes the given number of requests and events from the buckets. If the buckets do not contain
+// enough tokens wait either blocks until the tokens are available, or fails with ErrRateLimitExceeded if
+// the limiter is configured to fail fast.
+func (l *rateLimiter) wait(ctx context.Context, requests, events int) error {
+	if l == nil {
+		return nil
+	}
+
+	l.Lock()
+	now := l.now()
+	l.requests.advance(now)
+	l.events.advance(now)
+	if l.failFast && (!l.requests.available(requests) || !l.events.available(events)) {
+		l.Unlock()
+		return ErrRateLimitExceeded
+	}
+	delay := l.requests.take(requests)
+	if eventsDelay := l.events.take(events); eventsDelay > delay {
+		delay = eventsDelay
+	}
+	l.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		l.refund(requests, events)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// refund puts requests and events, which were taken by wait but not used, back into the buckets.
+func (l *rateLimiter) refund(requests, events int) {
+	if l == nil {
+		return
+	}
+	l.Lock()
+	defer l.Unlock()
+	l.requests.refund(requests)
+	l.events.refund(events)
+}
+
+// newTokenBucket creates a bucket which is initially full. If rate is not positive, newTokenBucket
+// returns nil, which is a valid bucket that never runs empty.
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// tokenBucket implements the token bucket algorithm. The number of tokens may become negative, if more
+// tokens than available were taken. The deficit is refilled before new tokens become available.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// advance refills the bucket according to the time passed since the last call.
+func (b *tokenBucket) advance(now time.Time) {
+	if b == nil {
+		return
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+}
+
+// available checks whether n tokens can be taken without delay. Requests for more tokens than the burst
+// size are available as soon as the bucket is full.
+func (b *tokenBucket) available(n int) bool {
+	if b == nil || n <= 0 {
+		return true
+	}
+	return b.tokens >= math.Min(float64(n), b.burst)
+}
+
+// take removes n tokens from the bucket and returns the time until the tokens are available.
+func (b *tokenBucket) take(n int) time.Duration {
+	if b == nil || n <= 0 {
+		return 0
+	}
+	deficit := math.Min(float64(n), b.burst) - b.tokens
+	b.tokens -= float64(n)
+	if deficit <= 0 {
+		return 0
+	}
+	return time.Duration(deficit / b.rate * float64(time.Second))
+}
+
+// refund puts n tokens, which were taken but not used, back into the bucket.
+func (b *tokenBucket) refund(n int) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.tokens = math.Min(b.burst, b.tokens+float64(n))
+}
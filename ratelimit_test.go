@@ -0,0 +1,191 @@
+package nakadi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	t.Run("no limit", func(t *testing.T) {
+		assert.Nil(t, newRateLimiter(nil))
+		assert.Nil(t, newRateLimiter(&RateLimit{FailFast: true}))
+		assert.NoError(t, (*rateLimiter)(nil).wait(context.Background(), 1, 100))
+	})
+
+	t.Run("default burst", func(t *testing.T) {
+		limiter := newRateLimiter(&RateLimit{RequestsPerSecond: 0.5, EventsPerSecond: 2.5})
+
+		require.NotNil(t, limiter)
+		assert.Equal(t, float64(1), limiter.requests.burst)
+		assert.Equal(t, float64(3), limiter.events.burst)
+	})
+}
+
+func TestRateLimiter_wait(t *testing.T) {
+	now := time.Date(2017, 8, 12, 7, 0, 0, 0, time.UTC)
+
+	t.Run("fail fast", func(t *testing.T) {
+		limiter := newRateLimiter(&RateLimit{RequestsPerSecond: 1, RequestBurst: 2, FailFast: true})
+		limiter.requests.last = now
+		limiter.now = func() time.Time { return now }
+
+		assert.NoError(t, limiter.wait(context.Background(), 1, 0))
+		assert.NoError(t, limiter.wait(context.Background(), 1, 0))
+		assert.Equal(t, ErrRateLimitExceeded, limiter.wait(context.Background(), 1, 0))
+
+		limiter.now = func() time.Time { return now.Add(time.Second) }
+		assert.NoError(t, limiter.wait(context.Background(), 1, 0))
+		assert.Equal(t, ErrRateLimitExceeded, limiter.wait(context.Background(), 1, 0))
+	})
+
+	t.Run("fail fast with large batch", func(t *testing.T) {
+		limiter := newRateLimiter(&RateLimit{EventsPerSecond: 10, FailFast: true})
+		limiter.events.last = now
+		limiter.now = func() time.Time { return now }
+
+		assert.NoError(t, limiter.wait(context.Background(), 1, 25))
+		assert.Equal(t, ErrRateLimitExceeded, limiter.wait(context.Background(), 1, 1))
+
+		limiter.now = func() time.Time { return now.Add(1500 * time.Millisecond) }
+		assert.Equal(t, ErrRateLimitExceeded, limiter.wait(context.Background(), 1, 1))
+
+		limiter.now = func() time.Time { return now.Add(1600 * time.Millisecond) }
+		assert.NoError(t, limiter.wait(context.Background(), 1, 1))
+	})
+
+	t.Run("success blocking", func(t *testing.T) {
+		limiter := newRateLimiter(&RateLimit{RequestsPerSecond: 20, RequestBurst: 1})
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			assert.NoError(t, limiter.wait(context.Background(), 1, 0))
+		}
+		assert.True(t, time.Since(start) >= 90*time.Millisecond)
+	})
+
+	t.Run("fail with canceled context", func(t *testing.T) {
+		limiter := newRateLimiter(&RateLimit{EventsPerSecond: 1})
+		require.NoError(t, limiter.wait(context.Background(), 0, 1))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := limiter.wait(ctx, 0, 1)
+		assert.Equal(t, context.DeadlineExceeded, err)
+		assert.True(t, limiter.events.tokens > -1)
+	})
+}
+
+func TestPublishAPI_rateLimit(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var requests int
+	url := defaultNakadiURL + "/event-types/test-event/events"
+	httpmock.RegisterResponder("POST", url, func(r *http.Request) (*http.Response, error) {
+		requests++
+		return httpmock.NewStringResponse(http.StatusOK, ""), nil
+	})
+	events := []DataChangeEvent{{}, {}, {}}
+
+	t.Run("fail fast with publish limit", func(t *testing.T) {
+		requests = 0
+		client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+		publishAPI := NewPublishAPI(client, "test-event", &PublishOptions{
+			RateLimit: &RateLimit{EventsPerSecond: 0.1, EventBurst: 5, FailFast: true}})
+
+		require.NoError(t, publishAPI.Publish(events))
+		err := publishAPI.Publish(events)
+
+		require.Error(t, err)
+		assert.Equal(t, ErrRateLimitExceeded, errors.Cause(err))
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("fail fast with client limit", func(t *testing.T) {
+		requests = 0
+		client := &Client{
+			nakadiURL:   defaultNakadiURL,
+			httpClient:  http.DefaultClient,
+			rateLimiter: newRateLimiter(&RateLimit{RequestsPerSecond: 0.1, FailFast: true})}
+		publishAPI := NewPublishAPI(client, "test-event", nil)
+
+		require.NoError(t, publishAPI.Publish(events))
+		err := publishAPI.Publish(events)
+
+		require.Error(t, err)
+		assert.ErrorIs(t, err, ErrRateLimitExceeded)
+		assert.Equal(t, 1, requests)
+
+		_, err = NewEventAPI(client, nil).List()
+		assert.ErrorIs(t, err, ErrRateLimitExceeded)
+	})
+
+	t.Run("retries count against client limit", func(t *testing.T) {
+		var attempts int
+		httpmock.RegisterResponder("GET", defaultNakadiURL+"/event-types", func(*http.Request) (*http.Response, error) {
+			attempts++
+			if attempts == 1 {
+				return httpmock.NewStringResponse(http.StatusServiceUnavailable, testProblemJSON), nil
+			}
+			return httpmock.NewStringResponse(http.StatusOK, "[]"), nil
+		})
+		client := &Client{
+			nakadiURL:   defaultNakadiURL,
+			httpClient:  http.DefaultClient,
+			rateLimiter: newRateLimiter(&RateLimit{RequestsPerSecond: 0.1, RequestBurst: 2, FailFast: true})}
+		eventAPI := NewEventAPI(client, &EventOptions{Retry: true, InitialRetryInterval: time.Millisecond})
+
+		_, err := eventAPI.List()
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+
+		_, err = eventAPI.List()
+		assert.ErrorIs(t, err, ErrRateLimitExceeded)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("refund publish limit if client limit fails", func(t *testing.T) {
+		requests = 0
+		client := &Client{
+			nakadiURL:   defaultNakadiURL,
+			httpClient:  http.DefaultClient,
+			rateLimiter: newRateLimiter(&RateLimit{EventsPerSecond: 0.1, EventBurst: 3, FailFast: true})}
+		publishAPI := NewPublishAPI(client, "test-event", &PublishOptions{
+			RateLimit: &RateLimit{RequestsPerSecond: 0.1, RequestBurst: 2, EventsPerSecond: 0.1, EventBurst: 6, FailFast: true}})
+
+		require.NoError(t, publishAPI.Publish(events))
+		err := publishAPI.Publish(events)
+
+		assert.ErrorIs(t, err, ErrRateLimitExceeded)
+		assert.Equal(t, 1, requests)
+		assert.True(t, publishAPI.rateLimiter.requests.available(1))
+		assert.True(t, publishAPI.rateLimiter.events.available(3))
+	})
+
+	t.Run("fail with canceled context", func(t *testing.T) {
+		requests = 0
+		client := &Client{
+			nakadiURL:   defaultNakadiURL,
+			httpClient:  http.DefaultClient,
+			rateLimiter: newRateLimiter(&RateLimit{EventsPerSecond: 0.1, EventBurst: 3})}
+		publishAPI := NewPublishAPI(client, "test-event", nil)
+
+		require.NoError(t, publishAPI.Publish(events))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		err := publishAPI.PublishContext(ctx, events)
+
+		require.Error(t, err)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Equal(t, 1, requests)
+	})
+}
@@ -0,0 +1,115 @@
+package nakadi
+
+import (
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	defaultRetryMultiplier = 1.5
+	defaultRetryJitter     = 0.5
+)
+
+// RetryPolicy describes how failed requests are retried. A retry policy can be passed to the options of
+// all sub APIs. If a retry policy is set, it takes precedence over the fields Retry, InitialRetryInterval,
+// MaxRetryInterval and MaxElapsedTime of the respective options.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one. 0 means that the number of
+	// attempts is only limited by MaxElapsedTime and 1 disables retries (default: 0)
+	MaxAttempts int
+	// InitialInterval is the interval before the first retry (default: 10ms)
+	InitialInterval time.Duration
+	// MaxInterval is the maximum interval between two retries (default: 10s)
+	MaxInterval time.Duration
+	// MaxElapsedTime is the maximum time spent on retries. A negative value means that retries are only
+	// limited by MaxAttempts (default: 30s)
+	MaxElapsedTime time.Duration
+	// Multiplier is the factor by which the retry interval grows after each attempt (default: 1.5)
+	Multiplier float64
+	// Jitter is the randomization factor applied to each retry interval, e.g. with a jitter of 0.5 an
+	// interval of 1s results in a random interval between 0.5s and 1.5s. A negative value disables
+	// jitter (default: 0.5)
+	Jitter float64
+	// RetryableStatus decides whether a response with the given status code is retried. Connection
+	// errors are always retried (default: status codes of 500 and above)
+	RetryableStatus func(statusCode int) bool
+	// NewBackOff creates the backoff used for each request. If set, the interval parameters of the
+	// policy are ignored, but MaxAttempts is still applied.
+	NewBackOff func() backoff.BackOff
+}
+
+func (p *RetryPolicy) withDefaults() *RetryPolicy {
+	var copyPolicy RetryPolicy
+	if p != nil {
+		copyPolicy = *p
+	}
+	if copyPolicy.InitialInterval == 0 {
+		copyPolicy.InitialInterval = defaultInitialRetryInterval
+	}
+	if copyPolicy.MaxInterval == 0 {
+		copyPolicy.MaxInterval = defaultMaxRetryInterval
+	}
+	if copyPolicy.MaxElapsedTime == 0 {
+		copyPolicy.MaxElapsedTime = defaultMaxElapsedTime
+	}
+	if copyPolicy.Multiplier == 0 {
+		copyPolicy.Multiplier = defaultRetryMultiplier
+	}
+	if copyPolicy.Jitter == 0 {
+		copyPolicy.Jitter = defaultRetryJitter
+	}
+	if copyPolicy.RetryableStatus == nil {
+		copyPolicy.RetryableStatus = defaultRetryableStatus
+	}
+	return &copyPolicy
+}
+
+// create initializes a new backoff according to the policy.
+func (p *RetryPolicy) create() backoff.BackOff {
+	var back backoff.BackOff
+	if p.NewBackOff != nil {
+		back = p.NewBackOff()
+	} else {
+		exponential := backoff.NewExponentialBackOff()
+		exponential.InitialInterval = p.InitialInterval
+		exponential.MaxInterval = p.MaxInterval
+		exponential.Multiplier = p.Multiplier
+		exponential.RandomizationFactor = p.Jitter
+		if p.Jitter < 0 {
+			exponential.RandomizationFactor = 0
+		}
+		exponential.MaxElapsedTime = p.MaxElapsedTime
+		if p.MaxElapsedTime < 0 {
+			exponential.MaxElapsedTime = 0
+		}
+		exponential.Reset()
+		back = exponential
+	}
+
+	if p.MaxAttempts > 0 {
+		back = backoff.WithMaxRetries(back, uint64(p.MaxAttempts-1))
+	}
+
+	return &policyBackOff{BackOff: back, retryableStatus: p.RetryableStatus}
+}
+
+// policyBackOff is a backoff created from a retry policy, which carries the policy's decision about
+// retryable status codes.
+type policyBackOff struct {
+	backoff.BackOff
+	retryableStatus func(int) bool
+}
+
+// isRetryableStatus checks whether a response with the given status code should be retried using the
+// backoff. Unless the backoff was created from a retry policy, status codes of 500 and above are retried.
+func isRetryableStatus(back backoff.BackOff, statusCode int) bool {
+	if policy, ok := back.(*policyBackOff); ok {
+		return policy.retryableStatus(statusCode)
+	}
+	return defaultRetryableStatus(statusCode)
+}
+
+func defaultRetryableStatus(statusCode int) bool {
+	return statusCode >= 500
+}
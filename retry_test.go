@@ -0,0 +1,116 @@
+package nakadi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_withDefaults(t *testing.T) {
+	policy := (&RetryPolicy{MaxAttempts: 3, Jitter: -1}).withDefaults()
+
+	assert.Equal(t, 3, policy.MaxAttempts)
+	assert.Equal(t, defaultInitialRetryInterval, policy.InitialInterval)
+	assert.Equal(t, defaultMaxRetryInterval, policy.MaxInterval)
+	assert.Equal(t, defaultMaxElapsedTime, policy.MaxElapsedTime)
+	assert.Equal(t, defaultRetryMultiplier, policy.Multiplier)
+	assert.Equal(t, float64(-1), policy.Jitter)
+	assert.True(t, policy.RetryableStatus(http.StatusServiceUnavailable))
+	assert.False(t, policy.RetryableStatus(http.StatusTooManyRequests))
+}
+
+func TestRetryPolicy_create(t *testing.T) {
+	t.Run("exponential without jitter", func(t *testing.T) {
+		policy := (&RetryPolicy{
+			InitialInterval: time.Second,
+			MaxInterval:     4 * time.Second,
+			MaxElapsedTime:  -1,
+			Multiplier:      2,
+			Jitter:          -1}).withDefaults()
+
+		back := policy.create()
+
+		var intervals []time.Duration
+		for i := 0; i < 4; i++ {
+			intervals = append(intervals, back.NextBackOff())
+		}
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}, intervals)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		policy := (&RetryPolicy{MaxAttempts: 3}).withDefaults()
+
+		back := policy.create()
+
+		assert.NotEqual(t, backoff.Stop, back.NextBackOff())
+		assert.NotEqual(t, backoff.Stop, back.NextBackOff())
+		assert.Equal(t, backoff.Stop, back.NextBackOff())
+	})
+
+	t.Run("custom backoff", func(t *testing.T) {
+		policy := (&RetryPolicy{
+			MaxAttempts: 2,
+			NewBackOff:  func() backoff.BackOff { return backoff.NewConstantBackOff(time.Minute) }}).withDefaults()
+
+		back := policy.create()
+
+		assert.Equal(t, time.Minute, back.NextBackOff())
+		assert.Equal(t, backoff.Stop, back.NextBackOff())
+	})
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	assert.True(t, isRetryableStatus(&backoff.StopBackOff{}, http.StatusInternalServerError))
+	assert.False(t, isRetryableStatus(&backoff.StopBackOff{}, http.StatusTooManyRequests))
+
+	policy := (&RetryPolicy{RetryableStatus: func(status int) bool { return status == http.StatusTooManyRequests }}).withDefaults()
+	assert.False(t, isRetryableStatus(policy.create(), http.StatusInternalServerError))
+	assert.True(t, isRetryableStatus(policy.create(), http.StatusTooManyRequests))
+}
+
+func TestEventAPI_retryPolicy(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	url := defaultNakadiURL + "/event-types"
+	var requests int
+	var status int
+	httpmock.RegisterResponder("GET", url, func(r *http.Request) (*http.Response, error) {
+		requests++
+		return httpmock.NewStringResponse(status, testProblemJSON), nil
+	})
+
+	eventAPI := NewEventAPI(client, &EventOptions{
+		Retry: false,
+		RetryPolicy: &RetryPolicy{
+			MaxAttempts:     3,
+			InitialInterval: time.Millisecond,
+			RetryableStatus: func(status int) bool { return status == http.StatusTooManyRequests }}})
+
+	t.Run("fail after max attempts", func(t *testing.T) {
+		requests = 0
+		status = http.StatusTooManyRequests
+
+		_, err := eventAPI.List()
+
+		require.Error(t, err)
+		assert.Regexp(t, "unable to request event types", err)
+		assert.Equal(t, 3, requests)
+	})
+
+	t.Run("fail without retry", func(t *testing.T) {
+		requests = 0
+		status = http.StatusInternalServerError
+
+		_, err := eventAPI.List()
+
+		require.Error(t, err)
+		assert.Equal(t, 1, requests)
+	})
+}
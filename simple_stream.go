@@ -3,12 +3,14 @@ package nakadi
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -21,25 +23,29 @@ type simpleStreamOpener struct {
 	batchLimit           uint
 	flushTimeout         uint
 	maxUncommittedEvents uint
+	streamLimit          uint
+	streamTimeout        uint
+	streamKeepAliveLimit uint
+	commitTimeout        uint
+	batchTimespan        uint
+	partitions           []StreamPartition
+	maxBatchSize         uint
 }
 
-func (so *simpleStreamOpener) openStream() (streamer, error) {
-	req, err := http.NewRequest("GET", so.streamURL(so.subscriptionID), nil)
+func (so *simpleStreamOpener) openStream(ctx context.Context) (streamer, error) {
+	req, err := so.streamRequest()
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to create request")
+		return nil, err
 	}
+	req = req.WithContext(ctx)
 
-	if so.client.tokenProvider != nil {
-		token, err := so.client.tokenProvider()
-		if err != nil {
-			return nil, errors.Wrap(err, "unable to open stream")
-		}
-		req.Header.Set("Authorization", "Bearer "+token)
+	if err := so.client.authorize(req); err != nil {
+		return nil, errors.Wrap(err, "unable to open stream")
 	}
 
-	response, err := so.client.httpStreamClient.Do(req)
+	response, err := so.client.do(so.client.httpStreamClient, req)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to create stream")
+		return nil, withFlowID(errors.Wrap(err, "unable to create stream"), req)
 	}
 
 	if response.StatusCode >= 400 {
@@ -47,19 +53,68 @@ func (so *simpleStreamOpener) openStream() (streamer, error) {
 		if err != nil {
 			return nil, errors.Wrap(err, "unable to read response body")
 		}
-		return nil, decodeResponseToError(buffer, "unable to open stream")
+		return nil, withFlowID(decodeResponseToError(buffer, "unable to open stream"), response.Request)
 	}
 
 	s := &simpleStream{
 		nakadiStreamID: response.Header.Get("X-Nakadi-StreamId"),
 		buffer:         bufio.NewReader(response.Body),
 		closer:         response.Body,
-		readTimeout:    2 * nakadiHeartbeatInterval,
+		readTimeout:    so.readTimeout(),
+		maxBatchSize:   int(so.maxBatchSize),
 	}
 
 	return s, nil
 }
 
+// streamRequest creates the request which opens a stream. Streams with requested partitions are opened
+// using a POST request, which carries the partitions and all stream parameters in its body.
+func (so *simpleStreamOpener) streamRequest() (*http.Request, error) {
+	if len(so.partitions) == 0 {
+		req, err := http.NewRequest("GET", so.streamURL(so.subscriptionID), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create request")
+		}
+		return req, nil
+	}
+
+	params := &streamParameters{
+		Partitions:           so.partitions,
+		BatchLimit:           so.batchLimit,
+		FlushTimeout:         so.flushTimeout,
+		MaxUncommittedEvents: so.maxUncommittedEvents,
+		StreamLimit:          so.streamLimit,
+		StreamTimeout:        so.streamTimeout,
+		StreamKeepAliveLimit: so.streamKeepAliveLimit,
+		CommitTimeout:        so.commitTimeout,
+		BatchTimespan:        so.batchTimespan}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode stream parameters")
+	}
+
+	eventsURL := fmt.Sprintf("%s/subscriptions/%s/events", so.client.nakadiURL, so.subscriptionID)
+	req, err := http.NewRequest("POST", eventsURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create request")
+	}
+	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	return req, nil
+}
+
+// streamParameters is the body of a POST request which opens a stream.
+type streamParameters struct {
+	Partitions           []StreamPartition `json:"partitions"`
+	BatchLimit           uint              `json:"batch_limit,omitempty"`
+	FlushTimeout         uint              `json:"batch_flush_timeout,omitempty"`
+	MaxUncommittedEvents uint              `json:"max_uncommitted_events,omitempty"`
+	StreamLimit          uint              `json:"stream_limit,omitempty"`
+	StreamTimeout        uint              `json:"stream_timeout,omitempty"`
+	StreamKeepAliveLimit uint              `json:"stream_keep_alive_limit,omitempty"`
+	CommitTimeout        uint              `json:"commit_timeout,omitempty"`
+	BatchTimespan        uint              `json:"batch_timespan,omitempty"`
+}
+
 func (so *simpleStreamOpener) streamURL(id string) string {
 	queryParams := url.Values{}
 	if so.batchLimit > 0 {
@@ -71,16 +126,84 @@ func (so *simpleStreamOpener) streamURL(id string) string {
 	if so.maxUncommittedEvents > 0 {
 		queryParams.Add("max_uncommitted_events", strconv.FormatUint(uint64(so.maxUncommittedEvents), 10))
 	}
+	if so.streamLimit > 0 {
+		queryParams.Add("stream_limit", strconv.FormatUint(uint64(so.streamLimit), 10))
+	}
+	if so.streamTimeout > 0 {
+		queryParams.Add("stream_timeout", strconv.FormatUint(uint64(so.streamTimeout), 10))
+	}
+	if so.streamKeepAliveLimit > 0 {
+		queryParams.Add("stream_keep_alive_limit", strconv.FormatUint(uint64(so.streamKeepAliveLimit), 10))
+	}
+	if so.commitTimeout > 0 {
+		queryParams.Add("commit_timeout", strconv.FormatUint(uint64(so.commitTimeout), 10))
+	}
+	if so.batchTimespan > 0 {
+		queryParams.Add("batch_timespan", strconv.FormatUint(uint64(so.batchTimespan), 10))
+	}
 
 	return fmt.Sprintf("%s/subscriptions/%s/events?%s", so.client.nakadiURL, id, queryParams.Encode())
 }
 
+// readTimeout returns the maximum time to wait for the next line of a stream. Nakadi sends a batch at
+// least once per flush timeout, which is 30 seconds unless configured otherwise. Batches limited by a
+// time span may take longer, therefore the greater value of both is used.
+func (so *simpleStreamOpener) readTimeout() time.Duration {
+	interval := nakadiHeartbeatInterval
+	if so.flushTimeout > 0 {
+		interval = time.Duration(so.flushTimeout) * time.Second
+	}
+	if timespan := time.Duration(so.batchTimespan) * time.Second; timespan > interval {
+		interval = timespan
+	}
+	return 2 * interval
+}
+
+// maxPooledLineBuffer is the maximum capacity of line buffers returned to the pool. Larger buffers are
+// discarded in order to release the memory of unusually large batches.
+const maxPooledLineBuffer = 1 << 20
+
+// lineBufferPool holds buffers used to assemble lines which are read in multiple fragments.
+var lineBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := make([]byte, 0, 64*1024)
+		return &buffer
+	},
+}
+
+func getLineBuffer() *[]byte {
+	buffer := lineBufferPool.Get().(*[]byte)
+	*buffer = (*buffer)[:0]
+	return buffer
+}
+
+func putLineBuffer(buffer *[]byte) {
+	if cap(*buffer) > maxPooledLineBuffer {
+		return
+	}
+	lineBufferPool.Put(buffer)
+}
+
+// BatchTooLargeError is returned by NextEvents when a batch exceeds the maximum batch size configured
+// in the StreamOptions. Since Nakadi would send the same batch again after a reconnect, the stream stops
+// reading and reports the state StreamFailed until it is closed.
+type BatchTooLargeError struct {
+	MaxBatchSize int
+}
+
+func (e *BatchTooLargeError) Error() string {
+	return fmt.Sprintf("batch exceeds the maximum size of %d bytes", e.MaxBatchSize)
+}
+
 // simpleStream implements the streamer interface.
 type simpleStream struct {
 	nakadiStreamID string
 	buffer         *bufio.Reader
 	closer         io.Closer
 	readTimeout    time.Duration
+	maxBatchSize   int
+	timer          *time.Timer
+	info           json.RawMessage
 }
 
 func (s *simpleStream) nextEvents() (Cursor, []byte, error) {
@@ -92,27 +215,43 @@ func (s *simpleStream) nextEvents() (Cursor, []byte, error) {
 	if err != nil {
 		return Cursor{}, nil, errors.Wrap(err, "failed to read next batch")
 	}
-	line := make([]byte, len(fragment))
-	copy(line, fragment)
 
-	for isPrefix {
-		var add []byte
-		add, isPrefix, err = s.readLineTimeout()
-		if err != nil {
-			return Cursor{}, nil, errors.Wrap(err, "failed to read next batch")
+	// the fragment is only valid until the next read, which is fine as long as the line is not read
+	// in multiple fragments, since json.Unmarshal copies all data it retains
+	line := fragment
+	if isPrefix {
+		buffer := getLineBuffer()
+		defer putLineBuffer(buffer)
+
+		*buffer = append(*buffer, fragment...)
+		for isPrefix {
+			var add []byte
+			add, isPrefix, err = s.readLineTimeout()
+			if err != nil {
+				return Cursor{}, nil, errors.Wrap(err, "failed to read next batch")
+			}
+			if s.maxBatchSize > 0 && len(*buffer)+len(add) > s.maxBatchSize {
+				return Cursor{}, nil, errors.Wrap(&BatchTooLargeError{MaxBatchSize: s.maxBatchSize}, "failed to read next batch")
+			}
+			*buffer = append(*buffer, add...)
 		}
-		line = append(line, add...)
+		line = *buffer
+	}
+	if s.maxBatchSize > 0 && len(line) > s.maxBatchSize {
+		return Cursor{}, nil, errors.Wrap(&BatchTooLargeError{MaxBatchSize: s.maxBatchSize}, "failed to read next batch")
 	}
 
 	batch := struct {
 		Cursor Cursor           `json:"cursor"`
 		Events *json.RawMessage `json:"events"`
+		Info   json.RawMessage  `json:"info"`
 	}{}
 	err = json.Unmarshal(line, &batch)
 	if err != nil {
 		return Cursor{}, nil, errors.Wrap(err, "failed to unmarshal next batch")
 	}
 	batch.Cursor.NakadiStreamID = s.nakadiStreamID
+	s.info = batch.Info
 
 	if batch.Events == nil {
 		return batch.Cursor, nil, nil
@@ -120,9 +259,21 @@ func (s *simpleStream) nextEvents() (Cursor, []byte, error) {
 	return batch.Cursor, *batch.Events, nil
 }
 
+// streamInfo returns the info object of the last batch read from the stream or nil if the batch
+// contained no info.
+func (s *simpleStream) streamInfo() json.RawMessage {
+	return s.info
+}
+
+// readLineTimeout reads the next line or fragment of a line from the stream. If no data was read within
+// the read timeout, the stream is closed. The timer is reused for all reads.
 func (s *simpleStream) readLineTimeout() ([]byte, bool, error) {
-	timer := time.AfterFunc(s.readTimeout, func() { s.closer.Close() })
-	defer timer.Stop()
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.readTimeout, func() { s.closer.Close() })
+	} else {
+		s.timer.Reset(s.readTimeout)
+	}
+	defer s.timer.Stop()
 	return s.buffer.ReadLine()
 }
 
@@ -137,45 +288,87 @@ type simpleCommitter struct {
 	subscriptionID string
 }
 
-func (s *simpleCommitter) commitCursor(cursor Cursor) error {
+func (s *simpleCommitter) commitCursor(ctx context.Context, cursor Cursor) error {
+	_, err := s.commitCursors(ctx, []Cursor{cursor})
+	return err
+}
+
+// commitCursors commits multiple cursors of the same stream with a single request and returns the result
+// for each cursor.
+func (s *simpleCommitter) commitCursors(ctx context.Context, cursors []Cursor) ([]CommitResult, error) {
 	wrap := &struct {
 		Items []Cursor `json:"items"`
-	}{Items: []Cursor{cursor}}
+	}{Items: cursors}
 
 	data, err := json.Marshal(wrap)
 	if err != nil {
-		return errors.Wrap(err, "unable to unmarshal cursor")
+		return nil, errors.Wrap(err, "unable to unmarshal cursor")
 	}
 
-	req, err := http.NewRequest("POST", s.commitURL(s.subscriptionID), bytes.NewReader(data))
+	streamID := cursors[0].NakadiStreamID
+	req, err := http.NewRequestWithContext(ctx, "POST", s.commitURL(s.subscriptionID), bytes.NewReader(data))
 	if err != nil {
-		return errors.Wrap(err, "unable to create request")
+		return nil, errors.Wrap(err, "unable to create request")
 	}
 	req.Header.Set("Content-Type", "application/json;charset=UTF-8")
-	req.Header.Set("X-Nakadi-StreamId", cursor.NakadiStreamID)
-	if s.client.tokenProvider != nil {
-		token, err := s.client.tokenProvider()
-		if err != nil {
-			return errors.Wrap(err, "unable to commit cursor")
-		}
-		req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Nakadi-StreamId", streamID)
+	if err := s.client.authorize(req); err != nil {
+		return nil, errors.Wrap(err, "unable to commit cursor")
 	}
 
-	response, err := s.client.httpClient.Do(req)
+	response, err := s.client.do(s.client.httpClient, req)
 	if err != nil {
-		return errors.Wrap(err, "unable to commit cursor")
+		return nil, withFlowID(errors.Wrap(err, "unable to commit cursor"), req)
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode >= 400 {
 		buffer, err := io.ReadAll(response.Body)
 		if err != nil {
-			return errors.Wrap(err, "unable to read response body")
+			return nil, errors.Wrap(err, "unable to read response body")
+		}
+		err = decodeResponseToError(buffer, "unable to commit cursor")
+		if response.StatusCode == http.StatusUnprocessableEntity && isStaleStreamProblem(buffer, streamID) {
+			err = &StaleStreamError{StreamID: streamID, Err: err}
+		}
+		return nil, withFlowID(err, response.Request)
+	}
+
+	results := &struct {
+		Items []CommitResult `json:"items"`
+	}{}
+	if response.StatusCode == http.StatusOK {
+		err := json.NewDecoder(response.Body).Decode(results)
+		if err != nil && err != io.EOF {
+			return nil, withFlowID(errors.Wrap(err, "unable to decode commit result"), req)
+		}
+	}
+
+	// Nakadi only reports results if at least one cursor is outdated, all other cursors were committed
+	if len(results.Items) == 0 {
+		for _, cursor := range cursors {
+			results.Items = append(results.Items, CommitResult{Cursor: cursor, Result: CommitResultCommitted})
 		}
-		return decodeResponseToError(buffer, "unable to commit cursor")
 	}
+	for i := range results.Items {
+		results.Items[i].Cursor.NakadiStreamID = streamID
+	}
+	return results.Items, nil
+}
 
-	return nil
+// staleStreamDetail is the detail of the problem which Nakadi returns along with status 422, if cursors are
+// committed with the ID of a stream which is no longer valid. Nakadi uses a generic title and type for this
+// problem, therefore the detail is the only way to tell it apart from other unprocessable commits.
+const staleStreamDetail = "Session with stream id %s not found"
+
+// isStaleStreamProblem checks whether a problem returned by Nakadi for a failed commit indicates that the
+// stream ID used for the commit is no longer valid.
+func isStaleStreamProblem(buffer []byte, streamID string) bool {
+	problem := problemJSON{}
+	if err := json.Unmarshal(buffer, &problem); err != nil {
+		return false
+	}
+	return problem.Detail == fmt.Sprintf(staleStreamDetail, streamID)
 }
 
 func (s *simpleCommitter) commitURL(id string) string {
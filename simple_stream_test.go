@@ -2,14 +2,21 @@ package nakadi
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/jarcoal/httpmock"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -46,7 +53,7 @@ func TestSimpleStreamOpener_openStream(t *testing.T) {
 		opener := setupOpener()
 		opener.client.tokenProvider = func() (string, error) { return "", assert.AnError }
 
-		_, err := opener.openStream()
+		_, err := opener.openStream(context.Background())
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError.Error(), err.Error())
 	})
@@ -55,7 +62,7 @@ func TestSimpleStreamOpener_openStream(t *testing.T) {
 		opener := setupOpener()
 		httpmock.RegisterResponder("GET", url, httpmock.NewErrorResponder(assert.AnError))
 
-		_, err := opener.openStream()
+		_, err := opener.openStream(context.Background())
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError.Error(), err.Error())
 	})
@@ -66,7 +73,7 @@ func TestSimpleStreamOpener_openStream(t *testing.T) {
 		responder, _ := httpmock.NewJsonResponder(400, &problem)
 		httpmock.RegisterResponder("GET", url, responder)
 
-		_, err := opener.openStream()
+		_, err := opener.openStream(context.Background())
 		require.Error(t, err)
 		assert.Regexp(t, problem.Detail, err.Error())
 	})
@@ -79,7 +86,7 @@ func TestSimpleStreamOpener_openStream(t *testing.T) {
 		})
 		httpmock.RegisterResponder("GET", url, responder)
 
-		_, err := opener.openStream()
+		_, err := opener.openStream(context.Background())
 		require.Error(t, err)
 		assert.Regexp(t, "unable to read response body", err.Error())
 	})
@@ -89,7 +96,7 @@ func TestSimpleStreamOpener_openStream(t *testing.T) {
 		responder, _ := httpmock.NewJsonResponder(200, sub)
 		httpmock.RegisterResponder("GET", url, responder)
 
-		stream, err := opener.openStream()
+		stream, err := opener.openStream(context.Background())
 		require.NoError(t, err)
 		require.NotNil(t, stream)
 	})
@@ -99,10 +106,63 @@ func TestSimpleStreamOpener_openStream(t *testing.T) {
 		responder, _ := httpmock.NewJsonResponder(200, sub)
 		httpmock.RegisterResponder("GET", url, responder)
 
-		stream, err := opener.openStream()
+		stream, err := opener.openStream(context.Background())
 		require.NoError(t, err)
 		require.NotNil(t, stream)
 	})
+
+	t.Run("success with partitions", func(t *testing.T) {
+		opener := setupOpener()
+		opener.batchLimit = 10
+		opener.partitions = []StreamPartition{{EventType: "test", Partition: "0"}}
+
+		var params map[string]interface{}
+		httpmock.RegisterResponder("POST", url, func(r *http.Request) (*http.Response, error) {
+			assert.Empty(t, r.URL.RawQuery)
+			if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+				return nil, err
+			}
+			return httpmock.NewJsonResponse(200, sub)
+		})
+
+		stream, err := opener.openStream(context.Background())
+		require.NoError(t, err)
+		require.NotNil(t, stream)
+		expected := map[string]interface{}{
+			"partitions":  []interface{}{map[string]interface{}{"event_type": "test", "partition": "0"}},
+			"batch_limit": float64(10),
+		}
+		assert.Equal(t, expected, params)
+	})
+}
+
+func TestSimpleStreamOpener_streamURL(t *testing.T) {
+	opener := &simpleStreamOpener{client: &Client{nakadiURL: defaultNakadiURL}}
+	assert.Equal(t, defaultNakadiURL+"/subscriptions/some-id/events?", opener.streamURL("some-id"))
+
+	opener.batchLimit = 10
+	opener.flushTimeout = 5
+	opener.maxUncommittedEvents = 100
+	opener.streamLimit = 1000
+	opener.streamTimeout = 600
+	opener.streamKeepAliveLimit = 3
+	opener.commitTimeout = 30
+	opener.batchTimespan = 2
+
+	assert.Equal(t, defaultNakadiURL+"/subscriptions/some-id/events?batch_flush_timeout=5&batch_limit=10&"+
+		"batch_timespan=2&commit_timeout=30&max_uncommitted_events=100&stream_keep_alive_limit=3&"+
+		"stream_limit=1000&stream_timeout=600", opener.streamURL("some-id"))
+}
+
+func TestSimpleStreamOpener_readTimeout(t *testing.T) {
+	opener := &simpleStreamOpener{}
+	assert.Equal(t, 2*nakadiHeartbeatInterval, opener.readTimeout())
+
+	opener.flushTimeout = 5
+	assert.Equal(t, 10*time.Second, opener.readTimeout())
+
+	opener.batchTimespan = 60
+	assert.Equal(t, 2*time.Minute, opener.readTimeout())
 }
 
 func TestSimpleStream_nextEvents(t *testing.T) {
@@ -159,6 +219,59 @@ func TestSimpleStream_nextEvents(t *testing.T) {
 			assert.Equal(t, "stream-id", cursor.NakadiStreamID)
 		}
 	})
+
+	t.Run("fail batch too large", func(t *testing.T) {
+		events := helperLoadTestData(t, "data-event-stream.json", nil)
+		stream := setupStream(httpmock.NewStringResponder(200, string(events)))
+		stream.maxBatchSize = 100
+
+		_, _, err := stream.nextEvents()
+		require.Error(t, err)
+		var sizeErr *BatchTooLargeError
+		require.True(t, errors.As(err, &sizeErr))
+		assert.Equal(t, 100, sizeErr.MaxBatchSize)
+		assert.Regexp(t, "batch exceeds the maximum size of 100 bytes", err)
+	})
+
+	t.Run("fail batch too large in single fragment", func(t *testing.T) {
+		events := helperLoadTestData(t, "data-event-stream.json", nil)
+		stream := setupStream(httpmock.NewStringResponder(200, string(events)))
+		stream.buffer = bufio.NewReader(stream.buffer)
+		stream.maxBatchSize = 100
+
+		_, _, err := stream.nextEvents()
+		require.Error(t, err)
+		assert.Regexp(t, "batch exceeds the maximum size", err)
+	})
+
+	t.Run("successfully read events within max batch size", func(t *testing.T) {
+		events := helperLoadTestData(t, "data-event-stream.json", nil)
+		stream := setupStream(httpmock.NewStringResponder(200, string(events)))
+		stream.maxBatchSize = len(events)
+
+		first, _, err := stream.nextEvents()
+		require.NoError(t, err)
+		second, _, err := stream.nextEvents()
+		require.NoError(t, err)
+		assert.Equal(t, "1", first.Offset)
+		assert.NotEqual(t, first.CursorToken, second.CursorToken)
+	})
+
+	t.Run("read info and keep alive", func(t *testing.T) {
+		stream := setupStream(httpmock.NewStringResponder(200,
+			`{"cursor":{"partition":"0","offset":"1"},"events":[{}],"info":{"debug":"Stream started"}}`+"\n"+
+				`{"cursor":{"partition":"0","offset":"1"}}`+"\n"))
+
+		_, events, err := stream.nextEvents()
+		require.NoError(t, err)
+		assert.NotEmpty(t, events)
+		assert.JSONEq(t, `{"debug":"Stream started"}`, string(stream.streamInfo()))
+
+		_, events, err = stream.nextEvents()
+		require.NoError(t, err)
+		assert.Nil(t, events)
+		assert.Nil(t, stream.streamInfo())
+	})
 }
 
 type fakeCloser struct {
@@ -205,7 +318,7 @@ func TestSimpleCommitter_commitEvents(t *testing.T) {
 		stream := setupCommitter(httpmock.NewStringResponder(200, ""))
 		stream.client.tokenProvider = func() (string, error) { return "", assert.AnError }
 
-		err := stream.commitCursor(Cursor{})
+		err := stream.commitCursor(context.Background(), Cursor{})
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
 	})
@@ -213,7 +326,7 @@ func TestSimpleCommitter_commitEvents(t *testing.T) {
 	t.Run("fail connect error", func(t *testing.T) {
 		stream := setupCommitter(httpmock.NewErrorResponder(assert.AnError))
 
-		err := stream.commitCursor(Cursor{})
+		err := stream.commitCursor(context.Background(), Cursor{})
 		require.Error(t, err)
 		assert.Regexp(t, assert.AnError, err)
 	})
@@ -223,7 +336,7 @@ func TestSimpleCommitter_commitEvents(t *testing.T) {
 		responder, _ := httpmock.NewJsonResponder(400, &problem)
 		stream := setupCommitter(responder)
 
-		err := stream.commitCursor(Cursor{})
+		err := stream.commitCursor(context.Background(), Cursor{})
 		require.Error(t, err)
 		assert.Regexp(t, problem.Detail, err)
 	})
@@ -235,7 +348,7 @@ func TestSimpleCommitter_commitEvents(t *testing.T) {
 		})
 		stream := setupCommitter(responder)
 
-		err := stream.commitCursor(Cursor{})
+		err := stream.commitCursor(context.Background(), Cursor{})
 		require.Error(t, err)
 		assert.Regexp(t, "unable to read response body", err)
 	})
@@ -243,7 +356,170 @@ func TestSimpleCommitter_commitEvents(t *testing.T) {
 	t.Run("successful commit", func(t *testing.T) {
 		stream := setupCommitter(httpmock.NewStringResponder(200, ""))
 
-		err := stream.commitCursor(Cursor{})
+		err := stream.commitCursor(context.Background(), Cursor{})
 		require.NoError(t, err)
 	})
+
+	t.Run("commit multiple cursors", func(t *testing.T) {
+		cursors := []Cursor{
+			{EventType: "test", Partition: "0", Offset: "5", NakadiStreamID: "stream-id"},
+			{EventType: "test", Partition: "1", Offset: "3", NakadiStreamID: "stream-id"}}
+		var body map[string][]Cursor
+		stream := setupCommitter(func(r *http.Request) (*http.Response, error) {
+			assert.Equal(t, "stream-id", r.Header.Get("X-Nakadi-StreamId"))
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				return nil, err
+			}
+			return httpmock.NewStringResponse(200, `{"items":[
+				{"cursor":{"event_type":"test","partition":"0","offset":"5"},"result":"committed"},
+				{"cursor":{"event_type":"test","partition":"1","offset":"3"},"result":"outdated"}]}`), nil
+		})
+
+		results, err := stream.commitCursors(context.Background(), cursors)
+		require.NoError(t, err)
+		assert.Len(t, body["items"], 2)
+		assert.Equal(t, []CommitResult{
+			{Cursor: cursors[0], Result: CommitResultCommitted},
+			{Cursor: cursors[1], Result: CommitResultOutdated}}, results)
+	})
+
+	t.Run("commit without results", func(t *testing.T) {
+		cursors := []Cursor{{EventType: "test", Partition: "0", Offset: "5", NakadiStreamID: "stream-id"}}
+		stream := setupCommitter(httpmock.NewStringResponder(http.StatusNoContent, ""))
+
+		results, err := stream.commitCursors(context.Background(), cursors)
+		require.NoError(t, err)
+		assert.Equal(t, []CommitResult{{Cursor: cursors[0], Result: CommitResultCommitted}}, results)
+	})
+
+	t.Run("fail with stale stream", func(t *testing.T) {
+		problem := &problemJSON{Detail: "Session with stream id stream-id not found", Status: 422}
+		responder, _ := httpmock.NewJsonResponder(http.StatusUnprocessableEntity, &problem)
+		stream := setupCommitter(responder)
+
+		err := stream.commitCursor(context.Background(), Cursor{NakadiStreamID: "stream-id"})
+		require.Error(t, err)
+		assert.Regexp(t, problem.Detail, err)
+		var staleErr *StaleStreamError
+		require.True(t, errors.As(err, &staleErr))
+		assert.Equal(t, "stream-id", staleErr.StreamID)
+	})
+
+	t.Run("fail with other unprocessable entity", func(t *testing.T) {
+		for _, detail := range []string{
+			"invalid cursor",
+			"Session with stream id other-stream-id not found",
+			"cursor of partition 0 is invalid for stream id stream-id"} {
+			problem := &problemJSON{Detail: detail, Status: 422}
+			responder, _ := httpmock.NewJsonResponder(http.StatusUnprocessableEntity, &problem)
+			stream := setupCommitter(responder)
+
+			err := stream.commitCursor(context.Background(), Cursor{NakadiStreamID: "stream-id"})
+			require.Error(t, err)
+			assert.False(t, isStaleStream(err), detail)
+		}
+	})
+}
+
+func TestIsStaleStreamProblem(t *testing.T) {
+	assert.True(t, isStaleStreamProblem([]byte(`{"detail":"Session with stream id stream-id not found"}`), "stream-id"))
+	assert.False(t, isStaleStreamProblem([]byte(`{"detail":"session with stream id stream-id not found"}`), "stream-id"))
+	assert.False(t, isStaleStreamProblem([]byte(`{"detail":"Stream ID stream-id is invalid"}`), "stream-id"))
+	assert.False(t, isStaleStreamProblem([]byte(`invalid`), "stream-id"))
+}
+
+func TestLineBufferPool(t *testing.T) {
+	buffer := getLineBuffer()
+	*buffer = append(*buffer, "foo"...)
+	putLineBuffer(buffer)
+	assert.Empty(t, *getLineBuffer())
+
+	large := make([]byte, 0, maxPooledLineBuffer+1)
+	assert.NotPanics(t, func() { putLineBuffer(&large) })
+}
+
+// BenchmarkSimpleStream_nextEvents compares nextEvents with copyNextEvents, which reads batches the way
+// the stream did before line buffers were pooled. Run with -benchmem to compare the allocations.
+func BenchmarkSimpleStream_nextEvents(b *testing.B) {
+	data, err := os.ReadFile(filepath.Join("testdata", "data-event-stream.json"))
+	require.NoError(b, err)
+	input := bytes.Repeat(data, 200)
+
+	benchmarks := []struct {
+		name       string
+		bufferSize int
+	}{
+		{name: "default buffer", bufferSize: 4096},
+		{name: "small buffer", bufferSize: 64},
+	}
+	readers := []struct {
+		name string
+		next func(*simpleStream) (Cursor, []byte, error)
+	}{
+		{name: "pooled", next: (*simpleStream).nextEvents},
+		{name: "copy", next: copyNextEvents},
+	}
+
+	for _, bm := range benchmarks {
+		for _, reader := range readers {
+			b.Run(bm.name+"/"+reader.name, func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(input)))
+				for i := 0; i < b.N; i++ {
+					stream := &simpleStream{
+						buffer:      bufio.NewReaderSize(bytes.NewReader(input), bm.bufferSize),
+						closer:      io.NopCloser(nil),
+						readTimeout: time.Minute}
+					for {
+						if _, _, err := reader.next(stream); err != nil {
+							break
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+// copyNextEvents is the former implementation of nextEvents, which copies each line into a newly
+// allocated buffer and creates a new timer for every read. It serves as baseline for the benchmark.
+func copyNextEvents(s *simpleStream) (Cursor, []byte, error) {
+	readLine := func() ([]byte, bool, error) {
+		timer := time.AfterFunc(s.readTimeout, func() { s.closer.Close() })
+		defer timer.Stop()
+		return s.buffer.ReadLine()
+	}
+
+	fragment, isPrefix, err := readLine()
+	if err != nil {
+		return Cursor{}, nil, errors.Wrap(err, "failed to read next batch")
+	}
+	line := make([]byte, len(fragment))
+	copy(line, fragment)
+
+	for isPrefix {
+		var add []byte
+		add, isPrefix, err = readLine()
+		if err != nil {
+			return Cursor{}, nil, errors.Wrap(err, "failed to read next batch")
+		}
+		line = append(line, add...)
+	}
+
+	batch := struct {
+		Cursor Cursor           `json:"cursor"`
+		Events *json.RawMessage `json:"events"`
+		Info   json.RawMessage  `json:"info"`
+	}{}
+	err = json.Unmarshal(line, &batch)
+	if err != nil {
+		return Cursor{}, nil, errors.Wrap(err, "failed to unmarshal next batch")
+	}
+	batch.Cursor.NakadiStreamID = s.nakadiStreamID
+	s.info = batch.Info
+
+	if batch.Events == nil {
+		return batch.Cursor, nil, nil
+	}
+	return batch.Cursor, *batch.Events, nil
 }
@@ -2,9 +2,15 @@ package nakadi
 
 import (
 	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	semconv "go.opentelemetry.io/otel/semconv/v1.31.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // A Cursor marks the current read position in a stream. It returned along with each received batch of
@@ -17,6 +23,65 @@ type Cursor struct {
 	NakadiStreamID string `json:"-"`
 }
 
+// Results of a cursor commit.
+const (
+	// CommitResultCommitted means that the cursor was committed.
+	CommitResultCommitted = "committed"
+	// CommitResultOutdated means that the cursor was not committed, because a more recent cursor of the
+	// same partition was committed before.
+	CommitResultOutdated = "outdated"
+)
+
+// CommitResult is the result of a commit for a single cursor.
+type CommitResult struct {
+	Cursor Cursor `json:"cursor"`
+	Result string `json:"result"`
+}
+
+// StaleStreamError is returned when cursors are committed using the ID of a stream which is no longer
+// valid, e.g. because Nakadi already closed the stream or its session expired. Cursors of a stale stream
+// can't be committed anymore, instead the respective events will be streamed again.
+type StaleStreamError struct {
+	StreamID string
+	Err      error
+}
+
+func (e *StaleStreamError) Error() string {
+	return e.Err.Error()
+}
+
+// Cause returns the underlying error.
+func (e *StaleStreamError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *StaleStreamError) Unwrap() error {
+	return e.Err
+}
+
+// ControlMessage represents a batch without events or a batch which carries an info object. Nakadi sends
+// batches without events as keep-alive, if no events were received within the flush timeout.
+type ControlMessage struct {
+	// Cursor is the cursor of the batch
+	Cursor Cursor
+	// KeepAlive is true if the batch contains no events
+	KeepAlive bool
+	// Info is the info object of the batch or nil if the batch carries no info
+	Info *StreamInfo
+}
+
+// StreamInfo is additional information about the stream, which Nakadi may send along with a batch.
+type StreamInfo struct {
+	// Debug is a debug message, e.g. sent when the stream was started
+	Debug string `json:"debug,omitempty"`
+	// Raw is the complete encoded info object
+	Raw json.RawMessage `json:"-"`
+}
+
+// ErrStreamClosed is returned by NextEvents once the stream was closed.
+var ErrStreamClosed = errors.New("stream closed")
+
 // StreamOptions contains optional parameters that are used to create a StreamAPI.
 type StreamOptions struct {
 	// The maximum number of Events in each chunk (and therefore per partition) of the stream (default: 1)
@@ -27,6 +92,33 @@ type StreamOptions struct {
 	// state and commit comes - the stream will resume. If MaxUncommittedEvents is lower than BatchLimit,
 	// effective batch size will be upperbound by MaxUncommittedEvents. (default: 10, minimum: 1)
 	MaxUncommittedEvents uint
+	// The maximum number of events in a stream. Once the limit was reached, Nakadi closes the stream and
+	// a new stream is opened. 0 means that the number of events is unlimited (default: 0)
+	StreamLimit uint
+	// Maximum time in seconds a stream lives before Nakadi closes it. Once the stream was closed, a new
+	// stream is opened. 0 means that the stream is not closed (default: 0)
+	StreamTimeout uint
+	// The maximum number of empty keep alive batches Nakadi sends in a row before the stream is closed.
+	// 0 means that the number of keep alive batches is unlimited (default: 0)
+	StreamKeepAliveLimit uint
+	// Maximum time in seconds Nakadi waits for the commit of a batch before the stream is closed. 0 means
+	// that Nakadi's default applies (default: 60)
+	CommitTimeout uint
+	// Time span in seconds which the received_at timestamps of the events in a batch may cover. Batches
+	// are flushed once the time span was reached. 0 means that batches are not limited by a time span
+	// (default: 0)
+	BatchTimespan uint
+	// The maximum size of a single batch in bytes. If a batch exceeds this size, reading the batch fails
+	// with a BatchTooLargeError. Since Nakadi would send the same batch again, the stream doesn't reconnect
+	// but stops in the state StreamFailed and the error is passed to NotifyErr. The stream has to be
+	// closed and MaxBatchSize or BatchLimit adjusted in order to continue. This protects against unbounded
+	// memory growth caused by pathological batches. 0 means that the size is unlimited (default: 0)
+	MaxBatchSize uint
+	// Partitions requests the given partitions from Nakadi instead of having them assigned automatically.
+	// If set, the stream is opened with a POST request and only receives events from these partitions.
+	// Other consumers of the subscription can't receive events from these partitions while the stream
+	// is open (default: nil)
+	Partitions []StreamPartition
 	// The initial (minimal) retry interval used for the exponential backoff. This value is applied for
 	// stream initialization as well as for cursor commits.
 	InitialRetryInterval time.Duration
@@ -41,12 +133,63 @@ type StreamOptions struct {
 	// set to true InitialRetryInterval, MaxRetryInterval, and CommitMaxElapsedTime have
 	// no effect for commit requests (default: false).
 	CommitRetry bool
+	// CommitInterval enables batch commits. If set, cursors passed to CommitCursor are buffered and the
+	// latest cursor of each partition is committed with a single request once per interval. Buffered
+	// cursors are committed when the stream is closed (default: 0, no batch commits)
+	CommitInterval time.Duration
+	// CommitThreshold enables batch commits as well. Buffered cursors are committed as soon as the given
+	// number of cursors was passed to CommitCursor. Without AsyncCommit and CommitInterval, the buffered
+	// cursors are committed at least once per second (default: 0, no threshold)
+	CommitThreshold uint
+	// AsyncCommit makes CommitCursor return as soon as the cursor was buffered instead of waiting until
+	// the buffered cursors were committed. Errors are only reported to OnCommit. Without AsyncCommit,
+	// CommitCursor blocks until the cursor was committed with the next interval or threshold commit, so
+	// that sequential callers wait up to CommitInterval per cursor. This option has no effect unless
+	// CommitInterval or CommitThreshold is set (default: false)
+	AsyncCommit bool
+	// OnCommit is called after buffered cursors were committed. Besides the cursors, it receives the
+	// cursors which were not committed because they are outdated, and the error if the commit failed.
+	OnCommit func(cursors, outdated []Cursor, err error)
 	// NotifyErr is called when an error occurs that leads to a retry. This notify function can be used to
-	// detect unhealthy streams.
+	// detect unhealthy streams. If the stream stops because of an error which can't be resolved by
+	// retrying, such as a BatchTooLargeError, NotifyErr is called with a duration of 0.
 	NotifyErr func(error, time.Duration)
 	// NotifyOK is called whenever a successful operation was completed. This notify function can be used
 	// to detect that a stream is healthy again.
 	NotifyOK func()
+	// OnPartitionsAssigned is called when partitions were assigned to the stream. Unless a previous
+	// callback is still running, it is called before the first batch of an assigned partition is returned
+	// by NextEvents. Assignments are derived from the cursors seen on the stream and from the subscription
+	// stats. The stats are retrieved in the background whenever a new partition was seen and every 30
+	// seconds, so partitions without events may be reported with a delay.
+	OnPartitionsAssigned func(partitions []StreamPartition)
+	// OnPartitionsRevoked is called when partitions were revoked from the stream, either because Nakadi
+	// assigned them to another stream or because the stream was interrupted or closed. Revocations by
+	// Nakadi are detected using the subscription stats, which may lag behind the stream. In order not to
+	// revoke partitions based on outdated stats, a partition is only revoked if it is missing from the
+	// stats twice in a row, so revocations are reported with a delay of up to 60 seconds. The callbacks
+	// are called in the order of the changes and never concurrently, but may be called from a different
+	// goroutine than the one reading the stream. Callbacks triggered by the background retrieval of the
+	// stats don't block reading the stream, but a callback triggered by a batch delays the batch.
+	OnPartitionsRevoked func(partitions []StreamPartition)
+	// OnControl is called for each batch without events (keep-alive) and for each batch which carries an
+	// info object. It can be used to implement liveness checks or to log debug messages sent by Nakadi.
+	// Batches without events are never returned by NextEvents (default: nil)
+	OnControl func(ControlMessage)
+	// Tracer is used to create a receive span for each batch read from the stream. If no tracer is set,
+	// no spans are created.
+	Tracer trace.Tracer
+	// RetryPolicy configures retries in more detail. If set, the policy is applied to stream
+	// initialization as well as to cursor commits and takes precedence over InitialRetryInterval,
+	// MaxRetryInterval, CommitMaxElapsedTime and CommitRetry.
+	RetryPolicy *RetryPolicy
+}
+
+// StreamPartition identifies a partition of an event type, which can be requested with the Partitions
+// field of StreamOptions.
+type StreamPartition struct {
+	EventType string `json:"event_type"`
+	Partition string `json:"partition"`
 }
 
 func (o *StreamOptions) withDefaults() *StreamOptions {
@@ -72,6 +215,9 @@ func (o *StreamOptions) withDefaults() *StreamOptions {
 	if copyOptions.MaxUncommittedEvents == 0 {
 		copyOptions.MaxUncommittedEvents = 10
 	}
+	if copyOptions.RetryPolicy != nil {
+		copyOptions.RetryPolicy = copyOptions.RetryPolicy.withDefaults()
+	}
 	return &copyOptions
 }
 
@@ -90,26 +236,49 @@ func NewStream(client *Client, subscriptionID string, options *StreamOptions) *S
 			subscriptionID:       subscriptionID,
 			batchLimit:           options.BatchLimit,
 			flushTimeout:         options.FlushTimeout,
-			maxUncommittedEvents: options.MaxUncommittedEvents},
+			maxUncommittedEvents: options.MaxUncommittedEvents,
+			streamLimit:          options.StreamLimit,
+			streamTimeout:        options.StreamTimeout,
+			streamKeepAliveLimit: options.StreamKeepAliveLimit,
+			commitTimeout:        options.CommitTimeout,
+			batchTimespan:        options.BatchTimespan,
+			partitions:           options.Partitions,
+			maxBatchSize:         options.MaxBatchSize},
 		committer: &simpleCommitter{
 			client:         client,
 			subscriptionID: subscriptionID},
-		eventCh: make(chan eventsOrError, 10),
-		ctx:     ctx,
-		cancel:  cancel,
+		eventCh:        make(chan eventsOrError, 10),
+		done:           make(chan struct{}),
+		health:         newStreamHealth(),
+		ctx:            ctx,
+		cancel:         cancel,
+		subscriptionID: subscriptionID,
+		metrics:        client.metrics,
 		streamBackOffConf: backOffConfiguration{
 			Retry:                true,
 			InitialRetryInterval: options.InitialRetryInterval,
 			MaxRetryInterval:     options.MaxRetryInterval,
+			Policy:               options.RetryPolicy,
 		},
 		commitBackOffConf: backOffConfiguration{
 			Retry:                options.CommitRetry,
 			InitialRetryInterval: options.InitialRetryInterval,
 			MaxRetryInterval:     options.MaxRetryInterval,
 			MaxElapsedTime:       options.CommitMaxElapsedTime,
+			Policy:               options.RetryPolicy,
 		},
 		notifyErr: options.NotifyErr,
-		notifyOK:  options.NotifyOK}
+		notifyOK:  options.NotifyOK,
+		tracer:    options.Tracer,
+		onControl: options.OnControl,
+		logger:    client.log().With("subscription_id", subscriptionID)}
+	streamAPI.partitions = newPartitionTracker(subscriptionID, NewSubscriptionAPI(client, nil),
+		options.OnPartitionsAssigned, options.OnPartitionsRevoked, streamAPI.logger)
+
+	if options.CommitInterval > 0 || options.CommitThreshold > 0 {
+		streamAPI.commits = newCommitBuffer(streamAPI.commitCursors, options.CommitInterval,
+			options.CommitThreshold, options.AsyncCommit, options.OnCommit)
+	}
 
 	go streamAPI.startStream()
 
@@ -123,59 +292,169 @@ type StreamAPI struct {
 	opener            streamOpener
 	committer         committer
 	eventCh           chan eventsOrError
+	done              chan struct{}
+	closeErr          error
+	health            *streamHealth
 	ctx               context.Context
 	cancel            context.CancelFunc
 	commitBackOffConf backOffConfiguration
 	streamBackOffConf backOffConfiguration
 	notifyErr         func(error, time.Duration)
 	notifyOK          func()
+	subscriptionID    string
+	metrics           *clientMetrics
+	tracer            trace.Tracer
+	onControl         func(ControlMessage)
+	logger            *slog.Logger
+	partitions        *partitionTracker
+	commits           *commitBuffer
+	active            activeStream
 }
 
 // NextEvents reads the next batch of events from the stream and returns the encoded events along with the
 // respective cursor. It blocks until the batch of events can be read from the stream, or the stream is closed.
+// Once the stream was closed, ErrStreamClosed is returned.
 func (s *StreamAPI) NextEvents() (Cursor, []byte, error) {
+	return s.NextEventsContext(context.Background())
+}
+
+// NextEventsContext is like NextEvents but stops waiting for the next batch of events once ctx is done. In
+// this case the error of ctx is returned.
+func (s *StreamAPI) NextEventsContext(ctx context.Context) (Cursor, []byte, error) {
+	cursor, events, _, err := s.nextTracedEvents(ctx)
+	return cursor, events, err
+}
+
+// nextTracedEvents works like NextEventsContext, but additionally returns the producer links of the batch,
+// which were extracted when the receive span was recorded. Without tracer, the links are nil.
+func (s *StreamAPI) nextTracedEvents(ctx context.Context) (Cursor, []byte, *batchTrace, error) {
+	if s.ctx.Err() != nil {
+		return Cursor{}, nil, nil, ErrStreamClosed
+	}
 	select {
+	case <-ctx.Done():
+		return Cursor{}, nil, nil, ctx.Err()
 	case <-s.ctx.Done():
-		return Cursor{}, nil, context.Canceled
-	case next := <-s.eventCh:
-		return next.cursor, next.events, next.err
+		return Cursor{}, nil, nil, ErrStreamClosed
+	case next, ok := <-s.eventCh:
+		if !ok || (next.err == context.Canceled && s.ctx.Err() != nil) {
+			return Cursor{}, nil, nil, ErrStreamClosed
+		}
+		return next.cursor, next.events, next.trace, next.err
 	}
 }
 
-// CommitCursor commits a cursor to Nakadi.
+// Status returns the current status of the stream, which can be used to check the health of the stream.
+func (s *StreamAPI) Status() StreamStatus {
+	return s.health.snapshot()
+}
+
+// CommitCursor commits a cursor to Nakadi. If batch commits are enabled, the cursor is buffered and
+// committed along with the cursors of other partitions.
 func (s *StreamAPI) CommitCursor(cursor Cursor) error {
-	commitBackOff := backoff.WithContext(s.commitBackOffConf.create(), s.ctx)
+	if s.commits != nil {
+		return s.commits.add(cursor)
+	}
+	return s.retryCommit(s.ctx, cursorLogAttrs(cursor), func() error {
+		return s.committer.commitCursor(s.ctx, cursor)
+	})
+}
+
+// CommitCursors commits multiple cursors of the current stream with a single request and returns the
+// result for each cursor. Cursors of the same partition are committed in the given order. Unlike
+// CommitCursor, CommitCursors doesn't use the buffer for batch commits.
+func (s *StreamAPI) CommitCursors(cursors ...Cursor) ([]CommitResult, error) {
+	if len(cursors) == 0 {
+		return nil, nil
+	}
+	return s.commitCursors(s.ctx, cursors)
+}
+
+// commitCursors commits cursors of the same stream with a single request and returns the result for each
+// cursor. Retries are stopped once ctx is done.
+func (s *StreamAPI) commitCursors(ctx context.Context, cursors []Cursor) ([]CommitResult, error) {
+	var results []CommitResult
+	attrs := []any{"stream_id", cursors[0].NakadiStreamID, "cursors", len(cursors)}
+	err := s.retryCommit(ctx, attrs, func() error {
+		var err error
+		results, err = s.committer.commitCursors(ctx, cursors)
+		return err
+	})
+	return results, err
+}
+
+// retryCommit performs a commit using the commit backoff and records the result. Retries are stopped once
+// ctx is done. If the commit failed because the stream is stale, the stream is interrupted in order to
+// reconnect immediately.
+func (s *StreamAPI) retryCommit(ctx context.Context, attrs []any, commit func() error) error {
+	start := time.Now()
+	commitBackOff := backoff.WithContext(s.commitBackOffConf.create(), ctx)
 	err := backoff.RetryNotify(func() error {
-		return s.committer.commitCursor(cursor)
-	}, commitBackOff, s.notifyErr)
+		err := commit()
+		if isCircuitOpen(err) || isStaleStream(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, commitBackOff, func(err error, wait time.Duration) {
+		s.logger.Warn("unable to commit cursor, retrying", append(attrs, "error", err, "backoff", wait)...)
+		s.notifyErr(err, wait)
+	})
+	s.metrics.recordCommit(s.subscriptionID, err, time.Since(start))
 
-	if err == nil {
-		s.notifyOK()
+	if err != nil {
+		s.logger.Error("unable to commit cursor", append(attrs, "error", err)...)
+		var staleErr *StaleStreamError
+		if errors.As(err, &staleErr) && s.active.interrupt(staleErr.StreamID) {
+			s.logger.Info("stream is stale, reconnecting", "stream_id", staleErr.StreamID)
+		}
+		return err
 	}
+	s.notifyOK()
 
-	return err
+	return nil
 }
 
-// Close ends the stream.
+// Close ends the stream. It waits until the background routine which consumes the stream terminated and
+// the connection to Nakadi was closed. Cursors buffered for batch commits are committed before the
+// connection is closed, since Nakadi only accepts commits with the ID of an open stream. The final commit
+// is canceled if it doesn't succeed within 10 seconds. The returned error is the error which occurred
+// when closing the connection.
 func (s *StreamAPI) Close() error {
+	if s.commits != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), closeCommitTimeout)
+		s.commits.close(ctx)
+		cancel()
+	}
 	s.cancel()
-	return nil
+	<-s.done
+	return s.closeErr
 }
 
 // startStream is used to start a background routine which consumes events using a streamOpener and streamer.
 // this routine will never terminate (not even on errors) unless the stream is closed.
 func (s *StreamAPI) startStream() {
-	for {
+	defer close(s.done)
+	defer close(s.eventCh)
+	defer s.health.closed()
+
+	for reconnect := false; ; reconnect = true {
 		var stream streamer
+		streamCtx, interrupt := context.WithCancel(s.ctx)
 
 		streamBackOff := backoff.WithContext(s.streamBackOffConf.create(), s.ctx)
 		err := backoff.RetryNotify(func() error {
 			var err error
-			stream, err = s.opener.openStream()
+			s.health.connecting()
+			stream, err = s.opener.openStream(streamCtx)
 			return err
-		}, streamBackOff, s.notifyErr)
+		}, streamBackOff, func(err error, wait time.Duration) {
+			s.logger.Warn("unable to open stream, retrying", "error", err, "backoff", wait)
+			s.health.failed(err, true)
+			s.notifyErr(err, wait)
+		})
 
 		if err != nil {
+			interrupt()
 			select {
 			case <-s.ctx.Done():
 				return
@@ -183,11 +462,21 @@ func (s *StreamAPI) startStream() {
 				continue
 			}
 		}
+		s.health.opened()
 		s.notifyOK()
+		if reconnect {
+			s.metrics.recordReconnect(s.subscriptionID)
+			s.logger.Info("stream reconnected")
+		} else {
+			s.logger.Debug("stream opened")
+		}
 
 		var cursor Cursor
 		var events []byte
+		var streamID string
 		for {
+			var traced *batchTrace
+			readStart := time.Now()
 			select {
 			case <-s.ctx.Done():
 				err = context.Canceled
@@ -195,34 +484,133 @@ func (s *StreamAPI) startStream() {
 				cursor, events, err = stream.nextEvents()
 			}
 
+			if err == nil {
+				streamID = cursor.NakadiStreamID
+				s.active.set(streamID, interrupt)
+				s.health.received(cursor, events)
+				s.partitions.observe(cursor)
+				s.control(stream, cursor, events)
+			}
 			if err == nil && len(events) == 0 {
 				continue
 			}
+			if err == nil {
+				s.metrics.recordBatch(s.subscriptionID)
+				traced = s.traceReceive(readStart, cursor, events)
+			}
 
 			select {
 			case <-s.ctx.Done():
 				err = context.Canceled
-			case s.eventCh <- eventsOrError{cursor: cursor, events: events, err: err}:
+			case s.eventCh <- eventsOrError{cursor: cursor, events: events, trace: traced, err: err}:
 				// nothing
 			}
 
 			if err != nil {
+				s.active.set("", nil)
+				s.partitions.reset()
 				if err == context.Canceled {
-					_ = stream.closeStream()
-					close(s.eventCh)
+					s.closeErr = stream.closeStream()
+					interrupt()
 					return
 				}
+				var tooLarge *BatchTooLargeError
+				if errors.As(err, &tooLarge) {
+					s.logger.Error("batch exceeds the maximum batch size, stream stopped", "stream_id", streamID, "error", err)
+					s.health.stopped(err)
+					s.notifyErr(err, 0)
+					s.closeStream(stream)
+					interrupt()
+					<-s.ctx.Done()
+					return
+				}
+				s.logger.Warn("stream interrupted, reconnecting", "stream_id", streamID, "error", err)
+				s.health.failed(err, false)
 				break
 			}
 		}
 
-		_ = stream.closeStream()
+		s.closeStream(stream)
+		interrupt()
+	}
+}
+
+// control logs the info object of a batch and passes keep-alive batches and batches which carry info to
+// the OnControl callback.
+func (s *StreamAPI) control(stream streamer, cursor Cursor, events []byte) {
+	var info *StreamInfo
+	if source, ok := stream.(infoStreamer); ok && len(source.streamInfo()) > 0 {
+		info = &StreamInfo{Raw: source.streamInfo()}
+		if err := json.Unmarshal(info.Raw, info); err != nil {
+			s.logger.Debug("unable to decode stream info", "stream_id", cursor.NakadiStreamID, "error", err)
+		}
+		s.logger.Debug("stream info received", "stream_id", cursor.NakadiStreamID, "info", string(info.Raw))
+	}
+
+	keepAlive := len(events) == 0
+	if s.onControl != nil && (keepAlive || info != nil) {
+		s.onControl(ControlMessage{Cursor: cursor, KeepAlive: keepAlive, Info: info})
+	}
+}
+
+// closeStream closes a stream and logs errors that may occur.
+func (s *StreamAPI) closeStream(stream streamer) {
+	if err := stream.closeStream(); err != nil {
+		s.logger.Debug("unable to close stream", "error", err)
+	}
+}
+
+// traceReceive records a receive span for a batch of events, which covers the time from the start of
+// the read until the batch was read. It returns the producer links of the batch, so that they can be
+// reused for the process span.
+func (s *StreamAPI) traceReceive(start time.Time, cursor Cursor, events []byte) *batchTrace {
+	if s.tracer == nil {
+		return nil
+	}
+	traced := newBatchTrace(events)
+	_, span := startMessagingSpan(s.ctx, s.tracer, semconv.MessagingOperationTypeReceive, "receive", cursor, traced,
+		trace.WithTimestamp(start))
+	span.SetAttributes(semconv.MessagingDestinationSubscriptionName(s.subscriptionID))
+	span.End()
+	return traced
+}
+
+// activeStream holds the ID of the stream which is currently consumed along with a function which
+// interrupts the stream.
+type activeStream struct {
+	sync.Mutex
+	streamID string
+	cancel   context.CancelFunc
+}
+
+func (a *activeStream) set(streamID string, interrupt context.CancelFunc) {
+	a.Lock()
+	defer a.Unlock()
+	a.streamID = streamID
+	a.cancel = interrupt
+}
+
+// interrupt interrupts the active stream if it has the given stream ID. It returns true if the stream
+// was interrupted.
+func (a *activeStream) interrupt(streamID string) bool {
+	a.Lock()
+	defer a.Unlock()
+	if a.cancel == nil || a.streamID != streamID {
+		return false
 	}
+	a.cancel()
+	return true
+}
+
+// isStaleStream checks whether an error was caused by a stale stream.
+func isStaleStream(err error) bool {
+	var staleErr *StaleStreamError
+	return errors.As(err, &staleErr)
 }
 
 // streamOpener is a internally used interface which is used to establish a new stream.
 type streamOpener interface {
-	openStream() (streamer, error)
+	openStream(ctx context.Context) (streamer, error)
 }
 
 // streamer is a internally used interface which is used to consume events from a stream.
@@ -231,14 +619,21 @@ type streamer interface {
 	closeStream() error
 }
 
+// infoStreamer is implemented by streamers which provide the info object of the last batch.
+type infoStreamer interface {
+	streamInfo() json.RawMessage
+}
+
 // committer is a internally used interface which is used to commit cursors.
 type committer interface {
-	commitCursor(cursor Cursor) error
+	commitCursor(ctx context.Context, cursor Cursor) error
+	commitCursors(ctx context.Context, cursors []Cursor) ([]CommitResult, error)
 }
 
 // eventsOrError is used to represent a successful or failed batch read.
 type eventsOrError struct {
 	cursor Cursor
 	events []byte
+	trace  *batchTrace
 	err    error
 }
@@ -2,12 +2,20 @@ package nakadi
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 func TestStreamAPI_startStreamLoop(t *testing.T) {
@@ -32,6 +40,40 @@ func TestStreamAPI_startStreamLoop(t *testing.T) {
 	// test will panic if openStream is called more than once.
 }
 
+func TestStreamAPI_startStream_batchTooLarge(t *testing.T) {
+	errorCh := make(chan error, 1)
+	stream := &mockStreamer{}
+	streamAPI, opener, _ := setupMockStream(errorCh, nil)
+	tooLarge := errors.Wrap(&BatchTooLargeError{MaxBatchSize: 100}, "failed to read next batch")
+
+	opener.On("openStream").Once().Return(stream, nil)
+	stream.On("nextEvents").Return(Cursor{NakadiStreamID: "stream-id"}, nil, tooLarge).Once()
+	stream.On("closeStream").Return(nil)
+
+	_, _, err := streamAPI.NextEvents()
+	assert.Equal(t, tooLarge, err)
+
+	select {
+	case err := <-errorCh:
+		assert.Equal(t, tooLarge, err)
+	case <-time.After(time.Second):
+		require.Fail(t, "error was not notified")
+	}
+
+	status := streamAPI.Status()
+	assert.Equal(t, StreamFailed, status.State)
+	assert.Equal(t, tooLarge, status.LastError)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = streamAPI.NextEventsContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	require.NoError(t, streamAPI.Close())
+	opener.AssertNumberOfCalls(t, "openStream", 1)
+	stream.AssertNumberOfCalls(t, "closeStream", 1)
+}
+
 func TestStreamAPI_startStream(t *testing.T) {
 	retryCh := make(chan error, 1)
 	okCh := make(chan struct{}, 1)
@@ -125,6 +167,75 @@ func TestStreamAPI_NextEvents(t *testing.T) {
 	})
 }
 
+func TestStreamAPI_NextEventsContext(t *testing.T) {
+	t.Run("fail with context", func(t *testing.T) {
+		streamAPI, opener, _ := setupMockStream(nil, nil)
+		opener.On("openStream").Return(nil, assert.AnError).Maybe()
+		defer streamAPI.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := streamAPI.NextEventsContext(ctx)
+
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("fail when closed", func(t *testing.T) {
+		stream := &mockStreamer{}
+		streamAPI, opener, _ := setupMockStream(nil, nil)
+		opener.On("openStream").Return(stream, nil)
+		stream.On("nextEvents").Return(Cursor{}, []byte{}, nil).Maybe()
+		stream.On("closeStream").Return(nil)
+
+		require.NoError(t, streamAPI.Close())
+		_, _, err := streamAPI.NextEventsContext(context.Background())
+		assert.Equal(t, ErrStreamClosed, err)
+		_, _, err = streamAPI.NextEvents()
+		assert.Equal(t, ErrStreamClosed, err)
+	})
+}
+
+func TestStreamAPI_traceReceive(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	exporter := tracetest.NewInMemoryExporter()
+	stream := &mockStreamer{}
+	streamAPI, opener, _ := setupMockStream(nil, nil)
+	streamAPI.tracer = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)).Tracer("test-tracer")
+	streamAPI.subscriptionID = testSubscriptionID
+
+	cursor := Cursor{Partition: "0", Offset: "001", EventType: "test-event.data", NakadiStreamID: "stream-id"}
+	events := `[{"metadata":{"eid":"1","span_ctx":{"traceparent":"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"}}},{"metadata":{"eid":"2"}}]`
+	opener.On("openStream").Return(stream, nil)
+	stream.On("nextEvents").Return(cursor, []byte(events), nil).After(20 * time.Millisecond).Once()
+	stream.On("nextEvents").Return(Cursor{}, []byte{}, nil).Maybe()
+	stream.On("closeStream").Return(nil)
+
+	_, _, traced, err := streamAPI.nextTracedEvents(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, traced)
+	assert.Equal(t, 2, traced.size)
+	require.Len(t, traced.links, 1)
+	assert.Equal(t, "0af7651916cd43dd8448eb211c80319c", traced.links[0].SpanContext.TraceID().String())
+	require.Eventually(t, func() bool { return len(exporter.GetSpans()) > 0 }, time.Second, 10*time.Millisecond)
+
+	span := exporter.GetSpans()[0]
+	assert.Equal(t, "receive test-event.data", span.Name)
+	assert.GreaterOrEqual(t, span.EndTime.Sub(span.StartTime), 20*time.Millisecond)
+	assert.Equal(t, traced.links[0].SpanContext, span.Links[0].SpanContext)
+	assert.Equal(t, oteltrace.SpanKindConsumer, span.SpanKind)
+	assert.Subset(t, span.Attributes, []attribute.KeyValue{
+		attribute.String("messaging.system", "nakadi"),
+		attribute.String("messaging.operation.type", "receive"),
+		attribute.String("messaging.destination.name", "test-event.data"),
+		attribute.String("messaging.destination.partition.id", "0"),
+		attribute.String("messaging.destination.subscription.name", testSubscriptionID),
+		attribute.Int("messaging.batch.message_count", 2),
+		attribute.String("nakadi.cursor.offset", "001"),
+		attribute.String("nakadi.stream.id", "stream-id"),
+	})
+	_ = streamAPI.Close()
+}
+
 func TestStreamAPI_CommitCursor(t *testing.T) {
 	retryCh := make(chan error, 1)
 	okCh := make(chan struct{}, 1)
@@ -195,13 +306,93 @@ func TestStreamAPI_CommitCursor(t *testing.T) {
 	})
 }
 
+func TestStreamAPI_CommitCursor_staleStream(t *testing.T) {
+	streamAPI, opener, committer := setupMockStream(nil, nil)
+	opener.On("openStream").Return(nil, assert.AnError).Maybe()
+	defer streamAPI.Close()
+
+	ctx, interrupt := context.WithCancel(context.Background())
+	defer interrupt()
+	streamAPI.active.set("stream-id", interrupt)
+
+	staleErr := &StaleStreamError{StreamID: "other-stream-id", Err: assert.AnError}
+	committer.On("commitCursor", Cursor{NakadiStreamID: "other-stream-id"}).Once().Return(staleErr)
+	err := streamAPI.CommitCursor(Cursor{NakadiStreamID: "other-stream-id"})
+	assert.Equal(t, staleErr, err)
+	assert.NoError(t, ctx.Err())
+
+	staleErr = &StaleStreamError{StreamID: "stream-id", Err: assert.AnError}
+	committer.On("commitCursor", Cursor{NakadiStreamID: "stream-id"}).Once().Return(staleErr)
+	err = streamAPI.CommitCursor(Cursor{NakadiStreamID: "stream-id"})
+	assert.Equal(t, staleErr, err)
+	assert.Equal(t, context.Canceled, ctx.Err())
+	committer.AssertExpectations(t)
+}
+
+func TestStreamAPI_CommitCursors(t *testing.T) {
+	streamAPI, opener, committer := setupMockStream(nil, nil)
+	opener.On("openStream").Return(nil, assert.AnError).Maybe()
+	defer streamAPI.Close()
+
+	cursors := []Cursor{{Partition: "0", NakadiStreamID: "stream-id"}, {Partition: "1", NakadiStreamID: "stream-id"}}
+	expected := []CommitResult{
+		{Cursor: cursors[0], Result: CommitResultCommitted},
+		{Cursor: cursors[1], Result: CommitResultOutdated}}
+	committer.On("commitCursors", cursors).Once().Return(expected, nil)
+
+	results, err := streamAPI.CommitCursors()
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = streamAPI.CommitCursors(cursors...)
+	require.NoError(t, err)
+	assert.Equal(t, expected, results)
+}
+
+func TestStreamAPI_control(t *testing.T) {
+	blockCh := make(chan time.Time, 1)
+	stream := &mockInfoStreamer{}
+	streamAPI, opener, _ := setupMockStream(nil, nil)
+	defer streamAPI.Close()
+
+	cursor := Cursor{Partition: "0", Offset: "1", NakadiStreamID: "stream-id"}
+	opener.On("openStream").Once().Return(stream, nil).WaitUntil(blockCh)
+	opener.On("openStream").Return(nil, assert.AnError).Maybe()
+	stream.On("nextEvents").Once().Return(cursor, []byte(`[{}]`), nil)
+	stream.On("streamInfo").Twice().Return(json.RawMessage(`{"debug":"Stream started"}`))
+	stream.On("nextEvents").Once().Return(cursor, []byte(nil), nil)
+	stream.On("streamInfo").Once().Return(json.RawMessage(nil))
+	stream.On("nextEvents").Return(Cursor{}, nil, assert.AnError)
+	stream.On("streamInfo").Return(json.RawMessage(nil)).Maybe()
+	stream.On("closeStream").Return(nil)
+
+	controlCh := make(chan ControlMessage, 10)
+	streamAPI.onControl = func(message ControlMessage) { controlCh <- message }
+	blockCh <- time.Now()
+
+	_, events, err := streamAPI.NextEvents()
+	require.NoError(t, err)
+	assert.NotEmpty(t, events)
+	_, _, err = streamAPI.NextEvents()
+	require.Error(t, err)
+
+	require.Len(t, controlCh, 2)
+	message := <-controlCh
+	assert.False(t, message.KeepAlive)
+	require.NotNil(t, message.Info)
+	assert.Equal(t, "Stream started", message.Info.Debug)
+	assert.JSONEq(t, `{"debug":"Stream started"}`, string(message.Info.Raw))
+	assert.Equal(t, ControlMessage{Cursor: cursor, KeepAlive: true}, <-controlCh)
+}
+
 func TestStreamAPI_Close(t *testing.T) {
 	errorCh := make(chan error, 1)
 	blockCh := make(chan time.Time, 1)
 	streamAPI, opener, _ := setupMockStream(nil, nil)
 
 	stream := &mockStreamer{}
-	opener.On("openStream").WaitUntil(blockCh).Return(stream, nil)
+	opener.On("openStream").WaitUntil(blockCh).Once().Return(stream, nil)
+	opener.On("openStream").Return(nil, assert.AnError).Maybe()
 	stream.On("nextEvents").WaitUntil(blockCh).Once().Return(Cursor{}, nil, assert.AnError)
 	stream.On("closeStream").Return(nil)
 
@@ -221,6 +412,18 @@ func TestStreamAPI_Close(t *testing.T) {
 	stream.AssertCalled(t, "closeStream")
 }
 
+func TestStreamAPI_Close_error(t *testing.T) {
+	stream := &mockStreamer{}
+	streamAPI, opener, _ := setupMockStream(nil, nil)
+	opener.On("openStream").Return(stream, nil)
+	stream.On("nextEvents").Return(Cursor{}, []byte{}, nil).Maybe()
+	stream.On("closeStream").Return(assert.AnError)
+
+	assert.Equal(t, assert.AnError, streamAPI.Close())
+	assert.Equal(t, assert.AnError, streamAPI.Close())
+	stream.AssertNumberOfCalls(t, "closeStream", 1)
+}
+
 func setupMockStream(errCh chan error, okCh chan struct{}) (*StreamAPI, *mockStreamOpener, *mockCommitter) {
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -230,7 +433,10 @@ func setupMockStream(errCh chan error, okCh chan struct{}) (*StreamAPI, *mockStr
 	stream := &StreamAPI{
 		opener:    opener,
 		committer: committer,
+		logger:    discardLogger,
 		eventCh:   make(chan eventsOrError, 10),
+		done:      make(chan struct{}),
+		health:    newStreamHealth(),
 		ctx:       ctx,
 		cancel:    cancel,
 		streamBackOffConf: backOffConfiguration{
@@ -265,7 +471,7 @@ type mockStreamOpener struct {
 	mock.Mock
 }
 
-func (so *mockStreamOpener) openStream() (streamer, error) {
+func (so *mockStreamOpener) openStream(_ context.Context) (streamer, error) {
 	args := so.Called()
 	if args.Error(1) != nil {
 		return nil, args.Error(1)
@@ -289,10 +495,28 @@ func (s *mockStreamer) closeStream() error {
 	return s.Called().Error(0)
 }
 
+type mockInfoStreamer struct {
+	mockStreamer
+}
+
+func (s *mockInfoStreamer) streamInfo() json.RawMessage {
+	info, _ := s.Called().Get(0).(json.RawMessage)
+	return info
+}
+
 type mockCommitter struct {
 	mock.Mock
 }
 
-func (c *mockCommitter) commitCursor(cursor Cursor) error {
+func (c *mockCommitter) commitCursor(_ context.Context, cursor Cursor) error {
 	return c.Called(cursor).Error(0)
 }
+
+func (c *mockCommitter) commitCursors(_ context.Context, cursors []Cursor) ([]CommitResult, error) {
+	args := c.Called(cursors)
+	if args.Error(1) != nil {
+		return nil, args.Error(1)
+	}
+	results, _ := args.Get(0).([]CommitResult)
+	return results, nil
+}
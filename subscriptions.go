@@ -1,10 +1,13 @@
 package nakadi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -49,6 +52,9 @@ type SubscriptionOptions struct {
 	// Once this value was reached the exponential backoff is halted and the request will
 	// fail with an error.
 	MaxElapsedTime time.Duration
+	// RetryPolicy configures retries in more detail. If set, the policy takes precedence over Retry,
+	// InitialRetryInterval, MaxRetryInterval and MaxElapsedTime.
+	RetryPolicy *RetryPolicy
 }
 
 func (o *SubscriptionOptions) withDefaults() *SubscriptionOptions {
@@ -65,6 +71,9 @@ func (o *SubscriptionOptions) withDefaults() *SubscriptionOptions {
 	if copyOptions.MaxElapsedTime == 0 {
 		copyOptions.MaxElapsedTime = defaultMaxElapsedTime
 	}
+	if copyOptions.RetryPolicy != nil {
+		copyOptions.RetryPolicy = copyOptions.RetryPolicy.withDefaults()
+	}
 	return &copyOptions
 }
 
@@ -80,7 +89,8 @@ func NewSubscriptionAPI(client *Client, options *SubscriptionOptions) *Subscript
 			Retry:                options.Retry,
 			InitialRetryInterval: options.InitialRetryInterval,
 			MaxRetryInterval:     options.MaxRetryInterval,
-			MaxElapsedTime:       options.MaxElapsedTime}}
+			MaxElapsedTime:       options.MaxElapsedTime,
+			Policy:               options.RetryPolicy}}
 }
 
 // SubscriptionAPI is a sub API that is used to manage subscriptions.
@@ -91,20 +101,70 @@ type SubscriptionAPI struct {
 
 // List returns all available subscriptions.
 func (s *SubscriptionAPI) List() ([]*Subscription, error) {
+	return s.ListContext(context.Background())
+}
+
+// ListContext works like List, but uses the given context for all requests. A flow ID carried by the
+// context is sent along with the requests, see ContextWithFlowID.
+func (s *SubscriptionAPI) ListContext(ctx context.Context) ([]*Subscription, error) {
 	subscriptions := struct {
 		Items []*Subscription `json:"items"`
 	}{}
-	err := s.client.httpGET(s.backOffConf.create(), s.subBaseURL(), &subscriptions, "unable to request subscriptions")
+	err := s.client.httpGET(ctx, s.backOffConf.create(), s.subBaseURL(), &subscriptions, "unable to request subscriptions")
 	if err != nil {
 		return nil, err
 	}
 	return subscriptions.Items, nil
 }
 
+// ListForEventType returns all subscriptions which consume events from the given event type. In
+// contrast to List, ListForEventType follows the pagination links returned by Nakadi and therefore
+// returns the complete set of matching subscriptions.
+func (s *SubscriptionAPI) ListForEventType(eventType string) ([]*Subscription, error) {
+	return s.ListForEventTypeContext(context.Background(), eventType)
+}
+
+// ListForEventTypeContext works like ListForEventType, but uses the given context for all requests. A flow
+// ID carried by the context is sent along with the requests, see ContextWithFlowID.
+func (s *SubscriptionAPI) ListForEventTypeContext(ctx context.Context, eventType string) ([]*Subscription, error) {
+	const errMsg = "unable to request subscriptions"
+	ctx = ensureFlowID(ctx)
+
+	query := url.Values{}
+	query.Set("event_type", eventType)
+	next := s.subBaseURL() + "?" + query.Encode()
+
+	var result []*Subscription
+	for next != "" {
+		page := subscriptionPage{}
+		err := s.client.httpGET(ctx, s.backOffConf.create(), next, &page, errMsg)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, page.Items...)
+
+		next = ""
+		if page.Links.Next != nil && page.Links.Next.Href != "" && len(page.Items) > 0 {
+			next = page.Links.Next.Href
+			if !strings.HasPrefix(next, "http://") && !strings.HasPrefix(next, "https://") {
+				next = s.client.nakadiURL + next
+			}
+		}
+	}
+
+	return result, nil
+}
+
 // Get obtains a single subscription identified by its ID.
 func (s *SubscriptionAPI) Get(id string) (*Subscription, error) {
+	return s.GetContext(context.Background(), id)
+}
+
+// GetContext works like Get, but uses the given context for all requests. A flow ID carried by the context
+// is sent along with the requests, see ContextWithFlowID.
+func (s *SubscriptionAPI) GetContext(ctx context.Context, id string) (*Subscription, error) {
 	subscription := &Subscription{}
-	err := s.client.httpGET(s.backOffConf.create(), s.subURL(id), subscription, "unable to request subscription")
+	err := s.client.httpGET(ctx, s.backOffConf.create(), s.subURL(id), subscription, "unable to request subscription")
 	if err != nil {
 		return nil, err
 	}
@@ -114,9 +174,15 @@ func (s *SubscriptionAPI) Get(id string) (*Subscription, error) {
 // Create initializes a new subscription. If the subscription already exists the pre-existing subscription
 // is returned.
 func (s *SubscriptionAPI) Create(subscription *Subscription) (*Subscription, error) {
+	return s.CreateContext(context.Background(), subscription)
+}
+
+// CreateContext works like Create, but uses the given context for all requests. A flow ID carried by the
+// context is sent along with the requests, see ContextWithFlowID.
+func (s *SubscriptionAPI) CreateContext(ctx context.Context, subscription *Subscription) (*Subscription, error) {
 	const errMsg = "unable to create subscription"
 
-	response, err := s.client.httpPOST(s.backOffConf.create(), s.subBaseURL(), subscription, errMsg)
+	response, err := s.client.httpPOST(ctx, s.backOffConf.create(), s.subBaseURL(), subscription, errMsg)
 	if err != nil {
 		return nil, err
 	}
@@ -127,7 +193,7 @@ func (s *SubscriptionAPI) Create(subscription *Subscription) (*Subscription, err
 		if err != nil {
 			return nil, errors.Wrapf(err, "%s: unable to read response body", errMsg)
 		}
-		return nil, decodeResponseToError(buffer, errMsg)
+		return nil, withFlowID(decodeResponseToError(buffer, errMsg), response.Request)
 	}
 
 	subscription = &Subscription{}
@@ -141,7 +207,13 @@ func (s *SubscriptionAPI) Create(subscription *Subscription) (*Subscription, err
 
 // Delete removes an existing subscription.
 func (s *SubscriptionAPI) Delete(id string) error {
-	return s.client.httpDELETE(s.backOffConf.create(), s.subURL(id), "unable to delete subscription")
+	return s.DeleteContext(context.Background(), id)
+}
+
+// DeleteContext works like Delete, but uses the given context for all requests. A flow ID carried by the
+// context is sent along with the requests, see ContextWithFlowID.
+func (s *SubscriptionAPI) DeleteContext(ctx context.Context, id string) error {
+	return s.client.httpDELETE(ctx, s.backOffConf.create(), s.subURL(id), "unable to delete subscription")
 }
 
 // SubscriptionStats represents detailed statistics for the subscription
@@ -158,14 +230,30 @@ type PartitionStats struct {
 	StreamID         string `json:"stream_id"`
 }
 
+// subscriptionPage is used to decode a single page of a paginated subscription list.
+type subscriptionPage struct {
+	Items []*Subscription `json:"items"`
+	Links struct {
+		Next *struct {
+			Href string `json:"href"`
+		} `json:"next"`
+	} `json:"_links"`
+}
+
 type statsResponse struct {
 	Items []*SubscriptionStats `json:"items"`
 }
 
 // GetStats returns statistic information for subscription
 func (s *SubscriptionAPI) GetStats(id string) ([]*SubscriptionStats, error) {
+	return s.GetStatsContext(context.Background(), id)
+}
+
+// GetStatsContext works like GetStats, but uses the given context for all requests. A flow ID carried by
+// the context is sent along with the requests, see ContextWithFlowID.
+func (s *SubscriptionAPI) GetStatsContext(ctx context.Context, id string) ([]*SubscriptionStats, error) {
 	stats := &statsResponse{}
-	if err := s.client.httpGET(s.backOffConf.create(), s.subURL(id)+"/stats", stats, "unable to get stats for subscription"); err != nil {
+	if err := s.client.httpGET(ctx, s.backOffConf.create(), s.subURL(id)+"/stats", stats, "unable to get stats for subscription"); err != nil {
 		return nil, err
 	}
 	return stats.Items, nil
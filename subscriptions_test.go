@@ -133,6 +133,55 @@ func TestSubscriptionAPI_List(t *testing.T) {
 	})
 }
 
+func TestSubscriptionAPI_ListForEventType(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var expected []*Subscription
+	helperLoadTestData(t, "subscriptions.json", &expected)
+
+	client := &Client{nakadiURL: defaultNakadiURL, httpClient: http.DefaultClient}
+	api := NewSubscriptionAPI(client, nil)
+	url := fmt.Sprintf("%s/subscriptions?event_type=test-event.data", defaultNakadiURL)
+	nextURL := fmt.Sprintf("%s/subscriptions?event_type=test-event.data&offset=2&limit=2", defaultNakadiURL)
+
+	t.Run("fail connection error", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", url, httpmock.NewErrorResponder(assert.AnError))
+
+		_, err := api.ListForEventType("test-event.data")
+		require.Error(t, err)
+		assert.Regexp(t, assert.AnError, err)
+	})
+
+	t.Run("fail with problem", func(t *testing.T) {
+		httpmock.RegisterResponder("GET", url, httpmock.NewStringResponder(http.StatusBadRequest, testProblemJSON))
+
+		_, err := api.ListForEventType("test-event.data")
+		require.Error(t, err)
+		assert.Regexp(t, "some problem detail", err)
+	})
+
+	t.Run("success with pagination", func(t *testing.T) {
+		first := map[string]interface{}{
+			"items":  expected[:2],
+			"_links": map[string]interface{}{"next": map[string]string{"href": "/subscriptions?event_type=test-event.data&offset=2&limit=2"}}}
+		second := map[string]interface{}{
+			"items":  expected[2:],
+			"_links": map[string]interface{}{}}
+
+		responder, err := httpmock.NewJsonResponder(http.StatusOK, first)
+		require.NoError(t, err)
+		httpmock.RegisterResponder("GET", url, responder)
+		responder, err = httpmock.NewJsonResponder(http.StatusOK, second)
+		require.NoError(t, err)
+		httpmock.RegisterResponder("GET", nextURL, responder)
+
+		subscriptions, err := api.ListForEventType("test-event.data")
+		require.NoError(t, err)
+		assert.Equal(t, expected, subscriptions)
+	})
+}
+
 func TestSubscriptionAPI_Create(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
@@ -0,0 +1,212 @@
+package nakadi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultTokenRefreshAhead = time.Minute
+	defaultTokenTimeout      = 10 * time.Second
+)
+
+// A Token is an access token along with its expiry. A zero Expiry means that the token does not expire.
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+}
+
+// TokenSource obtains a new token e.g. from an authorization server.
+type TokenSource func() (*Token, error)
+
+// NewCachingTokenProvider creates a token provider that caches tokens obtained from source. A new token
+// is requested from the source once the cached token is about to expire within refreshAhead. If the
+// refresh fails, the cached token is used until it actually expires. Use the Token method of the provider
+// as TokenProvider and its Invalidate method as TokenInvalidator in the ClientOptions.
+func NewCachingTokenProvider(source TokenSource, refreshAhead time.Duration) *CachingTokenProvider {
+	if refreshAhead == 0 {
+		refreshAhead = defaultTokenRefreshAhead
+	}
+	return &CachingTokenProvider{source: source, refreshAhead: refreshAhead, now: time.Now}
+}
+
+// CachingTokenProvider is a token provider which caches tokens until they expire.
+type CachingTokenProvider struct {
+	sync.Mutex
+	source       TokenSource
+	refreshAhead time.Duration
+	token        *Token
+	now          func() time.Time
+}
+
+// Token returns the cached access token or requests a new token if necessary.
+func (p *CachingTokenProvider) Token() (string, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	now := p.now()
+	if p.token != nil && (p.token.Expiry.IsZero() || now.Before(p.token.Expiry.Add(-p.refreshAhead))) {
+		return p.token.AccessToken, nil
+	}
+
+	token, err := p.source()
+	if err == nil && token == nil {
+		err = errors.New("token source returned no token")
+	}
+	if err != nil {
+		if p.token != nil && now.Before(p.token.Expiry) {
+			return p.token.AccessToken, nil
+		}
+		return "", errors.Wrap(err, "unable to obtain token")
+	}
+	p.token = token
+
+	return token.AccessToken, nil
+}
+
+// Invalidate removes the cached token, the next call of Token will request a new one.
+func (p *CachingTokenProvider) Invalidate() {
+	p.Lock()
+	defer p.Unlock()
+	p.token = nil
+}
+
+// NewFileTokenProvider creates a token provider that reads the token from a file, e.g. a credentials
+// file mounted into a container. The file is read again whenever its modification time or size changes.
+func NewFileTokenProvider(path string) *FileTokenProvider {
+	return &FileTokenProvider{path: path}
+}
+
+// FileTokenProvider is a token provider which reads tokens from a file.
+type FileTokenProvider struct {
+	sync.Mutex
+	path    string
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+// Token returns the token stored in the file. The file is only read if it has changed since the last call.
+func (p *FileTokenProvider) Token() (string, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read token file")
+	}
+	if p.token != "" && info.ModTime().Equal(p.modTime) && info.Size() == p.size {
+		return p.token, nil
+	}
+
+	encoded, err := os.ReadFile(p.path)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read token file")
+	}
+	token := strings.TrimSpace(string(encoded))
+	if token == "" {
+		return "", errors.Errorf("unable to read token file: %s is empty", p.path)
+	}
+
+	p.token, p.modTime, p.size = token, info.ModTime(), info.Size()
+	return p.token, nil
+}
+
+// Invalidate forces the file to be read again on the next call of Token.
+func (p *FileTokenProvider) Invalidate() {
+	p.Lock()
+	defer p.Unlock()
+	p.token = ""
+}
+
+// OAuth2Options contains the parameters of an OAuth2 client credentials grant.
+type OAuth2Options struct {
+	// The URL of the token endpoint of the authorization server.
+	TokenURL string
+	// The client ID used to authenticate at the authorization server.
+	ClientID string
+	// The client secret used to authenticate at the authorization server.
+	ClientSecret string
+	// The scopes that are requested.
+	Scopes []string
+	// RefreshAhead is the time before the expiry of a token at which a new token is requested (default: 1 minute)
+	RefreshAhead time.Duration
+	// HTTPClient is used to request tokens (default: a client with a timeout of 10 seconds)
+	HTTPClient *http.Client
+}
+
+// NewOAuth2TokenProvider creates a caching token provider, which obtains tokens from an authorization
+// server using the OAuth2 client credentials grant.
+func NewOAuth2TokenProvider(options *OAuth2Options) *CachingTokenProvider {
+	httpClient := options.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTokenTimeout}
+	}
+	source := &clientCredentials{options: *options, httpClient: httpClient, now: time.Now}
+	return NewCachingTokenProvider(source.token, options.RefreshAhead)
+}
+
+// clientCredentials implements the OAuth2 client credentials grant.
+type clientCredentials struct {
+	options    OAuth2Options
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+func (c *clientCredentials) token() (*Token, error) {
+	const errMsg = "unable to request token"
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(c.options.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.options.Scopes, " "))
+	}
+
+	request, err := http.NewRequest("POST", c.options.TokenURL, bytes.NewReader([]byte(form.Encode())))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: unable to prepare request", errMsg)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(c.options.ClientID), url.QueryEscape(c.options.ClientSecret))
+
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, errMsg)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		buffer, err := io.ReadAll(response.Body)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: unable to read response body", errMsg)
+		}
+		return nil, decodeResponseToError(buffer, errMsg)
+	}
+
+	body := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}{}
+	err = json.NewDecoder(response.Body).Decode(&body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: unable to decode response body", errMsg)
+	}
+	if body.AccessToken == "" {
+		return nil, errors.Errorf("%s: response contains no access token", errMsg)
+	}
+
+	token := &Token{AccessToken: body.AccessToken}
+	if body.ExpiresIn > 0 {
+		token.Expiry = c.now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
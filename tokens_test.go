@@ -0,0 +1,166 @@
+package nakadi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachingTokenProvider_Token(t *testing.T) {
+	now := time.Date(2017, 8, 12, 7, 0, 0, 0, time.UTC)
+	var provider *CachingTokenProvider
+	var calls int
+	var sourceErr error
+	source := func() (*Token, error) {
+		calls++
+		if sourceErr != nil {
+			return nil, sourceErr
+		}
+		return &Token{AccessToken: testToken + string(rune('0'+calls)), Expiry: provider.now().Add(10 * time.Minute)}, nil
+	}
+
+	provider = NewCachingTokenProvider(source, time.Minute)
+	provider.now = func() time.Time { return now }
+
+	t.Run("success cached", func(t *testing.T) {
+		token, err := provider.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "token1", token)
+
+		token, err = provider.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "token1", token)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("success refresh ahead", func(t *testing.T) {
+		provider.now = func() time.Time { return now.Add(9*time.Minute + time.Second) }
+
+		token, err := provider.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "token2", token)
+	})
+
+	t.Run("success refresh failed", func(t *testing.T) {
+		sourceErr = assert.AnError
+		provider.now = func() time.Time { return now.Add(18*time.Minute + 30*time.Second) }
+
+		token, err := provider.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "token2", token)
+	})
+
+	t.Run("fail token expired", func(t *testing.T) {
+		provider.now = func() time.Time { return now.Add(20*time.Minute + time.Second) }
+
+		_, err := provider.Token()
+		require.Error(t, err)
+		assert.Regexp(t, "unable to obtain token", err)
+	})
+
+	t.Run("success invalidated", func(t *testing.T) {
+		sourceErr = nil
+		provider.now = func() time.Time { return now }
+		provider.Invalidate()
+
+		token, err := provider.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "token5", token)
+	})
+
+	t.Run("fail no token after invalidation", func(t *testing.T) {
+		provider := NewCachingTokenProvider(func() (*Token, error) { return nil, nil }, time.Minute)
+		provider.Invalidate()
+
+		_, err := provider.Token()
+		require.Error(t, err)
+		assert.Regexp(t, "unable to obtain token: token source returned no token", err)
+	})
+}
+
+func TestFileTokenProvider_Token(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token-secret")
+	provider := NewFileTokenProvider(path)
+
+	t.Run("fail missing file", func(t *testing.T) {
+		_, err := provider.Token()
+		require.Error(t, err)
+		assert.Regexp(t, "unable to read token file", err)
+	})
+
+	t.Run("fail empty file", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("\n"), 0600))
+
+		_, err := provider.Token()
+		require.Error(t, err)
+		assert.Regexp(t, "is empty", err)
+	})
+
+	t.Run("success reload on change", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("first-token\n"), 0600))
+
+		token, err := provider.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "first-token", token)
+
+		require.NoError(t, os.WriteFile(path, []byte("second-token-value\n"), 0600))
+		later := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(path, later, later))
+
+		token, err = provider.Token()
+		require.NoError(t, err)
+		assert.Equal(t, "second-token-value", token)
+	})
+}
+
+func TestNewOAuth2TokenProvider(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "client-id" || password != "client-secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"title":"Unauthorized","status":401,"detail":"bad credentials"}`))
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "nakadi.read nakadi.write", r.PostForm.Get("scope"))
+		_, _ = w.Write([]byte(`{"access_token":"oauth-token","token_type":"Bearer","expires_in":3600}`))
+	}))
+	defer server.Close()
+
+	t.Run("fail with invalid credentials", func(t *testing.T) {
+		provider := NewOAuth2TokenProvider(&OAuth2Options{
+			TokenURL:     server.URL,
+			ClientID:     "client-id",
+			ClientSecret: "wrong-secret"})
+
+		_, err := provider.Token()
+		require.Error(t, err)
+		assert.Regexp(t, "unable to request token: bad credentials", err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		calls = 0
+		provider := NewOAuth2TokenProvider(&OAuth2Options{
+			TokenURL:     server.URL,
+			ClientID:     "client-id",
+			ClientSecret: "client-secret",
+			Scopes:       []string{"nakadi.read", "nakadi.write"}})
+
+		for i := 0; i < 3; i++ {
+			token, err := provider.Token()
+			require.NoError(t, err)
+			assert.Equal(t, "oauth-token", token)
+		}
+		assert.Equal(t, 1, calls)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), provider.token.Expiry, time.Minute)
+	})
+}
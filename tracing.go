@@ -1,12 +1,15 @@
 package nakadi
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptrace"
 	"strings"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.31.0"
 	"go.opentelemetry.io/otel/trace"
@@ -125,3 +128,171 @@ func getOperationName(reqPath, reqMethod string) string {
 
 	return operationName
 }
+
+// spanContextCarrier returns the span context of ctx encoded by the global text map propagator. If ctx
+// does not carry a valid span context, nil is returned.
+func spanContextCarrier(ctx context.Context) propagation.MapCarrier {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// injectSpanContext writes the span context of ctx into the metadata field span_ctx of each event.
+// Events may either be a single event or a batch of events. Events which already have a span context
+// or do not have metadata are left untouched. If ctx has no span context, events are returned unmodified.
+func injectSpanContext(ctx context.Context, events interface{}) (interface{}, error) {
+	carrier := spanContextCarrier(ctx)
+	if carrier == nil {
+		return events, nil
+	}
+
+	spanCtx, err := json.Marshal(carrier)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+	var batch []json.RawMessage
+	if err = json.Unmarshal(encoded, &batch); err != nil || batch == nil {
+		return withSpanContext(encoded, spanCtx)
+	}
+
+	for i, event := range batch {
+		batch[i], err = withSpanContext(event, spanCtx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return batch, nil
+}
+
+// withSpanContext sets the metadata field span_ctx of a single json encoded event to the encoded
+// span context.
+func withSpanContext(event json.RawMessage, spanCtx json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(event, &fields); err != nil || fields["metadata"] == nil {
+		return event, nil
+	}
+	var metadata map[string]json.RawMessage
+	if err := json.Unmarshal(fields["metadata"], &metadata); err != nil || metadata == nil {
+		return event, nil
+	}
+	if _, ok := metadata["span_ctx"]; ok {
+		return event, nil
+	}
+
+	var err error
+	metadata["span_ctx"] = spanCtx
+	if fields["metadata"], err = json.Marshal(metadata); err != nil {
+		return nil, err
+	}
+	return json.Marshal(fields)
+}
+
+// SpanContext returns the span context of the producer of the event, which is stored in the field
+// span_ctx of the metadata. If the event does not carry a valid span context, an invalid
+// trace.SpanContext is returned.
+func (m *EventMetadata) SpanContext() trace.SpanContext {
+	if len(m.SpanCtx) == 0 {
+		return trace.SpanContext{}
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(m.SpanCtx))
+	return trace.SpanContextFromContext(ctx)
+}
+
+// StartEventSpan starts a consumer span for a single event, which is linked to the span of the
+// producer of the event. The caller is responsible to end the returned span.
+func StartEventSpan(ctx context.Context, tracer trace.Tracer, metadata *EventMetadata) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindConsumer)}
+	if producer := metadata.SpanContext(); producer.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: producer}))
+	}
+	return tracer.Start(ctx, "process_event", opts...)
+}
+
+// StartBatchSpan starts a consumer span for a batch of events as returned by StreamAPI.NextEvents. The
+// span is linked to the spans of the producers of all events in the batch and is described by OTel
+// messaging semantic conventions. The caller is responsible to end the returned span.
+func StartBatchSpan(ctx context.Context, tracer trace.Tracer, cursor Cursor, events []byte) (context.Context, trace.Span) {
+	return startMessagingSpan(ctx, tracer, semconv.MessagingOperationTypeProcess, "process", cursor, newBatchTrace(events))
+}
+
+// startMessagingSpan starts a consumer span for a batch of events, which is linked to the spans of the
+// producers of the events.
+func startMessagingSpan(ctx context.Context, tracer trace.Tracer, operationType attribute.KeyValue, operationName string,
+	cursor Cursor, batch *batchTrace, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttributes(operationType, operationName, cursor)...),
+		trace.WithAttributes(semconv.MessagingBatchMessageCount(batch.size)))
+	if len(batch.links) > 0 {
+		opts = append(opts, trace.WithLinks(batch.links...))
+	}
+	return tracer.Start(ctx, messagingSpanName(operationName, cursor), opts...)
+}
+
+// messagingAttributes returns attributes according to OTel messaging semantic conventions, which
+// describe an operation on the batch of events identified by cursor.
+func messagingAttributes(operationType attribute.KeyValue, operationName string, cursor Cursor) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemKey.String("nakadi"),
+		operationType,
+		semconv.MessagingOperationName(operationName),
+		semconv.MessagingDestinationName(cursor.EventType),
+		semconv.MessagingDestinationPartitionID(cursor.Partition),
+		attribute.String("nakadi.cursor.offset", cursor.Offset)}
+	if cursor.NakadiStreamID != "" {
+		attrs = append(attrs, attribute.String("nakadi.stream.id", cursor.NakadiStreamID))
+	}
+	return attrs
+}
+
+// messagingSpanName returns a span name in the format "{operation name} {destination}".
+func messagingSpanName(operationName string, cursor Cursor) string {
+	if cursor.EventType == "" {
+		return operationName
+	}
+	return operationName + " " + cursor.EventType
+}
+
+// batchTrace contains the links to the spans of the producers of a batch of events along with the number
+// of events in the batch. It is extracted once per batch and shared by the receive and process spans.
+type batchTrace struct {
+	links []trace.Link
+	size  int
+}
+
+// newBatchTrace extracts the span contexts of all events of a json encoded batch.
+func newBatchTrace(events []byte) *batchTrace {
+	var batch []struct {
+		Metadata EventMetadata `json:"metadata"`
+	}
+	if err := json.Unmarshal(events, &batch); err != nil {
+		return &batchTrace{}
+	}
+
+	traced := &batchTrace{size: len(batch)}
+	for i := range batch {
+		if producer := batch[i].Metadata.SpanContext(); producer.IsValid() {
+			traced.links = append(traced.links, trace.Link{SpanContext: producer})
+		}
+	}
+	return traced
+}
+
+// endSpan marks a span as failed if err is not nil and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -1,6 +1,8 @@
 package nakadi
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 
 	"net/http/httptest"
@@ -8,10 +10,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 func TestTracingTransport(t *testing.T) {
@@ -66,7 +71,7 @@ func TestTracingTransport(t *testing.T) {
 
 			req := httptest.NewRequest(http.MethodGet, ts.URL, nil)
 
-			client := newHTTPClient(0, NewTracingMiddleware(&tt.tracingOptions))
+			client := newHTTPClient(0, nil, NewTracingMiddleware(&tt.tracingOptions))
 			rt := client.Transport
 			resp, err := rt.RoundTrip(req)
 
@@ -142,3 +147,143 @@ func TestGetOperationName(t *testing.T) {
 		})
 	}
 }
+
+func TestInjectSpanContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	tracer := trace.NewTracerProvider().Tracer("test-tracer")
+	ctx, span := tracer.Start(context.Background(), "publish")
+	defer span.End()
+
+	t.Run("no span context", func(t *testing.T) {
+		events := []SomeUndefinedEvent{{Test: "test"}}
+
+		injected, err := injectSpanContext(context.Background(), events)
+		require.NoError(t, err)
+		assert.Equal(t, events, injected)
+	})
+
+	t.Run("batch of events", func(t *testing.T) {
+		events := []interface{}{
+			SomeUndefinedEvent{Test: "test"},
+			SomeUndefinedEvent{UndefinedEvent: UndefinedEvent{Metadata: EventMetadata{SpanCtx: map[string]string{"key": "value"}}}},
+			SomeData{Test: "no metadata"}}
+
+		injected, err := injectSpanContext(ctx, events)
+		require.NoError(t, err)
+
+		encoded, err := json.Marshal(injected)
+		require.NoError(t, err)
+		decoded := []SomeUndefinedEvent{}
+		require.NoError(t, json.Unmarshal(encoded, &decoded))
+
+		require.Len(t, decoded, 3)
+		assert.Equal(t, "test", decoded[0].Test)
+		assert.Equal(t, span.SpanContext().TraceID(), decoded[0].Metadata.SpanContext().TraceID())
+		assert.Equal(t, span.SpanContext().SpanID(), decoded[0].Metadata.SpanContext().SpanID())
+		assert.Equal(t, map[string]string{"key": "value"}, decoded[1].Metadata.SpanCtx)
+		assert.Nil(t, decoded[2].Metadata.SpanCtx)
+	})
+
+	t.Run("metadata objects only", func(t *testing.T) {
+		carrier := propagation.MapCarrier{}
+		otel.GetTextMapPropagator().Inject(ctx, carrier)
+		spanCtx, err := json.Marshal(carrier)
+		require.NoError(t, err)
+
+		events := []interface{}{
+			map[string]interface{}{"metadata": map[string]interface{}{}},
+			map[string]interface{}{"a": `"metadata":{`, "metadata": map[string]interface{}{"eid": "1"}},
+			map[string]interface{}{"data": map[string]interface{}{"metadata": map[string]interface{}{}}},
+			map[string]interface{}{"metadata": "not an object"},
+			[]int{1, 2},
+			"metadata"}
+
+		injected, err := injectSpanContext(ctx, events)
+		require.NoError(t, err)
+
+		expected := []string{
+			`{"metadata":{"span_ctx":` + string(spanCtx) + `}}`,
+			`{"a":"\"metadata\":{","metadata":{"span_ctx":` + string(spanCtx) + `,"eid":"1"}}`,
+			`{"data":{"metadata":{}}}`,
+			`{"metadata":"not an object"}`,
+			`[1,2]`,
+			`"metadata"`}
+		require.IsType(t, []json.RawMessage{}, injected)
+		require.Len(t, injected, len(expected))
+		for i, event := range injected.([]json.RawMessage) {
+			assert.JSONEq(t, expected[i], string(event))
+		}
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		injected, err := injectSpanContext(ctx, []SomeUndefinedEvent{})
+		require.NoError(t, err)
+		assert.Equal(t, []json.RawMessage{}, injected)
+	})
+
+	t.Run("single event", func(t *testing.T) {
+		injected, err := injectSpanContext(ctx, &SomeUndefinedEvent{Test: "test"})
+		require.NoError(t, err)
+
+		encoded, err := json.Marshal(injected)
+		require.NoError(t, err)
+		decoded := SomeUndefinedEvent{}
+		require.NoError(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, span.SpanContext().SpanID(), decoded.Metadata.SpanContext().SpanID())
+	})
+}
+
+func TestStartBatchSpan(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := trace.NewTracerProvider(trace.WithSyncer(exporter)).Tracer("test-tracer")
+
+	_, producer := tracer.Start(context.Background(), "publish")
+	producer.End()
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(oteltrace.ContextWithSpan(context.Background(), producer), carrier)
+
+	events, err := json.Marshal([]SomeUndefinedEvent{
+		{UndefinedEvent: UndefinedEvent{Metadata: EventMetadata{EID: "1", SpanCtx: carrier}}},
+		{UndefinedEvent: UndefinedEvent{Metadata: EventMetadata{EID: "2"}}}})
+	require.NoError(t, err)
+
+	_, span := StartBatchSpan(context.Background(), tracer, Cursor{Partition: "0", EventType: "test-event.undefined"}, events)
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "process test-event.undefined", spans[1].Name)
+	assert.Equal(t, oteltrace.SpanKindConsumer, spans[1].SpanKind)
+	assert.Subset(t, spans[1].Attributes, []attribute.KeyValue{
+		attribute.String("messaging.system", "nakadi"),
+		attribute.String("messaging.operation.type", "process"),
+		attribute.String("messaging.destination.name", "test-event.undefined"),
+		attribute.String("messaging.destination.partition.id", "0"),
+		attribute.Int("messaging.batch.message_count", 2),
+	})
+	require.Len(t, spans[1].Links, 1)
+	assert.Equal(t, producer.SpanContext().SpanID(), spans[1].Links[0].SpanContext.SpanID())
+}
+
+func TestStartEventSpan(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	exporter := tracetest.NewInMemoryExporter()
+	tracer := trace.NewTracerProvider(trace.WithSyncer(exporter)).Tracer("test-tracer")
+
+	_, producer := tracer.Start(context.Background(), "publish")
+	producer.End()
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(oteltrace.ContextWithSpan(context.Background(), producer), carrier)
+
+	_, span := StartEventSpan(context.Background(), tracer, &EventMetadata{SpanCtx: carrier})
+	span.End()
+	_, span = StartEventSpan(context.Background(), tracer, &EventMetadata{})
+	span.End()
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	require.Len(t, spans[1].Links, 1)
+	assert.Equal(t, producer.SpanContext().SpanID(), spans[1].Links[0].SpanContext.SpanID())
+	assert.Empty(t, spans[2].Links)
+}
@@ -0,0 +1,90 @@
+package nakadi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TransportOptions contains optional parameters of the underlying http transports. The options are
+// applied to the transports of both, the non-streaming and the streaming http client.
+type TransportOptions struct {
+	// TLSConfig is used as base TLS configuration. The configuration is cloned before RootCAs and
+	// Certificates are applied.
+	TLSConfig *tls.Config
+	// RootCAs is the set of root certificate authorities used to verify the certificate of Nakadi.
+	// If nil, the host's root CA set is used. Use LoadCABundle to read a pool from PEM files.
+	RootCAs *x509.CertPool
+	// Certificates are presented to Nakadi when mutual TLS is required. Use tls.LoadX509KeyPair in
+	// order to load a certificate from files.
+	Certificates []tls.Certificate
+	// ProxyURL is the URL of a proxy server used for all requests. If nil, the proxy is determined
+	// by the environment variables HTTP_PROXY, HTTPS_PROXY and NO_PROXY.
+	ProxyURL *url.URL
+	// MaxIdleConns controls the maximum number of idle connections (default: 100)
+	MaxIdleConns int
+	// MaxIdleConnsPerHost controls the maximum number of idle connections per host (default: 2)
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is the maximum amount of time an idle connection remains open (default: 90s for
+	// non-streaming requests and 60s for streaming requests)
+	IdleConnTimeout time.Duration
+	// EnableHTTP2 enables HTTP/2 for connections to Nakadi if supported by the server (default: false)
+	EnableHTTP2 bool
+}
+
+// apply configures a transport according to the options. The options may be nil.
+func (o *TransportOptions) apply(t *http.Transport) {
+	if o == nil {
+		return
+	}
+
+	if o.TLSConfig != nil || o.RootCAs != nil || len(o.Certificates) > 0 {
+		var tlsConfig *tls.Config
+		if o.TLSConfig != nil {
+			tlsConfig = o.TLSConfig.Clone()
+		} else {
+			tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if o.RootCAs != nil {
+			tlsConfig.RootCAs = o.RootCAs
+		}
+		if len(o.Certificates) > 0 {
+			tlsConfig.Certificates = o.Certificates
+		}
+		t.TLSClientConfig = tlsConfig
+	}
+	if o.ProxyURL != nil {
+		t.Proxy = http.ProxyURL(o.ProxyURL)
+	}
+	if o.MaxIdleConns > 0 {
+		t.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = o.IdleConnTimeout
+	}
+	t.ForceAttemptHTTP2 = o.EnableHTTP2
+}
+
+// LoadCABundle reads PEM encoded certificates from one or many files and returns them as a certificate
+// pool, which can be used as RootCAs in TransportOptions.
+func LoadCABundle(paths ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, path := range paths {
+		encoded, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read CA bundle")
+		}
+		if !pool.AppendCertsFromPEM(encoded) {
+			return nil, errors.Errorf("unable to read CA bundle: no certificates found in %s", path)
+		}
+	}
+	return pool, nil
+}
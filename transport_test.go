@@ -0,0 +1,109 @@
+package nakadi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportOptions_apply(t *testing.T) {
+	t.Run("nil options", func(t *testing.T) {
+		transport := &http.Transport{MaxIdleConns: 100}
+		(*TransportOptions)(nil).apply(transport)
+
+		assert.Equal(t, &http.Transport{MaxIdleConns: 100}, transport)
+	})
+
+	t.Run("all options", func(t *testing.T) {
+		proxyURL, err := url.Parse("http://proxy.example.com:3128")
+		require.NoError(t, err)
+		pool := x509.NewCertPool()
+		certificate := tls.Certificate{Certificate: [][]byte{[]byte("certificate")}}
+		baseConfig := &tls.Config{ServerName: "nakadi.example.com"}
+
+		transport := &http.Transport{MaxIdleConns: 100}
+		options := &TransportOptions{
+			TLSConfig:           baseConfig,
+			RootCAs:             pool,
+			Certificates:        []tls.Certificate{certificate},
+			ProxyURL:            proxyURL,
+			MaxIdleConns:        10,
+			MaxIdleConnsPerHost: 5,
+			IdleConnTimeout:     time.Second,
+			EnableHTTP2:         true}
+		options.apply(transport)
+
+		require.NotNil(t, transport.TLSClientConfig)
+		assert.Equal(t, "nakadi.example.com", transport.TLSClientConfig.ServerName)
+		assert.Same(t, pool, transport.TLSClientConfig.RootCAs)
+		assert.Equal(t, []tls.Certificate{certificate}, transport.TLSClientConfig.Certificates)
+		assert.Nil(t, baseConfig.RootCAs)
+
+		request, err := http.NewRequest("GET", defaultNakadiURL, nil)
+		require.NoError(t, err)
+		requestProxy, err := transport.Proxy(request)
+		require.NoError(t, err)
+		assert.Equal(t, proxyURL, requestProxy)
+
+		assert.Equal(t, 10, transport.MaxIdleConns)
+		assert.Equal(t, 5, transport.MaxIdleConnsPerHost)
+		assert.Equal(t, time.Second, transport.IdleConnTimeout)
+		assert.True(t, transport.ForceAttemptHTTP2)
+	})
+
+	t.Run("applied to both clients", func(t *testing.T) {
+		client := New(defaultNakadiURL, &ClientOptions{Transport: &TransportOptions{MaxIdleConnsPerHost: 7}})
+
+		assert.Equal(t, 7, client.httpClient.Transport.(*http.Transport).MaxIdleConnsPerHost)
+		assert.Equal(t, 7, client.httpStreamClient.Transport.(*http.Transport).MaxIdleConnsPerHost)
+	})
+}
+
+func TestLoadCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"items":[]}`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	bundle := filepath.Join(dir, "ca.pem")
+	encoded := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, encoded, 0600))
+	invalid := filepath.Join(dir, "invalid.pem")
+	require.NoError(t, os.WriteFile(invalid, []byte("no certificate"), 0600))
+
+	t.Run("fail missing file", func(t *testing.T) {
+		_, err := LoadCABundle(filepath.Join(dir, "missing.pem"))
+		require.Error(t, err)
+		assert.Regexp(t, "unable to read CA bundle", err)
+	})
+
+	t.Run("fail invalid file", func(t *testing.T) {
+		_, err := LoadCABundle(invalid)
+		require.Error(t, err)
+		assert.Regexp(t, "no certificates found", err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		pool, err := LoadCABundle(bundle)
+		require.NoError(t, err)
+
+		client := New(server.URL, &ClientOptions{Transport: &TransportOptions{RootCAs: pool}})
+		_, err = NewSubscriptionAPI(client, nil).List()
+		assert.NoError(t, err)
+
+		client = New(server.URL, nil)
+		_, err = NewSubscriptionAPI(client, nil).List()
+		assert.Error(t, err)
+	})
+}
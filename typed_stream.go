@@ -0,0 +1,194 @@
+package nakadi
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Codec decodes JSON encoded events. It can be used to replace encoding/json with a different JSON library.
+type Codec interface {
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// jsonCodec implements the Codec interface using encoding/json.
+type jsonCodec struct{}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// TypedStreamOptions contains optional parameters that are used to create a TypedStream.
+type TypedStreamOptions struct {
+	// Codec is used to decode events (default: encoding/json)
+	Codec Codec
+}
+
+func (o *TypedStreamOptions) withDefaults() *TypedStreamOptions {
+	var copyOptions TypedStreamOptions
+	if o != nil {
+		copyOptions = *o
+	}
+	if copyOptions.Codec == nil {
+		copyOptions.Codec = jsonCodec{}
+	}
+	return &copyOptions
+}
+
+// eventSource is a contract that is used internally in order to be able to mock StreamAPI.
+type eventSource interface {
+	NextEventsContext(ctx context.Context) (Cursor, []byte, error)
+	CommitCursor(cursor Cursor) error
+	Close() error
+}
+
+// NewTypedStream wraps a StreamAPI in order to decode the events of each batch into values of type T. T is
+// usually a struct which embeds UndefinedEvent, which provides access to the metadata of the events. The
+// options may be nil.
+func NewTypedStream[T any](stream *StreamAPI, options *TypedStreamOptions) *TypedStream[T] {
+	options = options.withDefaults()
+	return &TypedStream[T]{source: stream, codec: options.Codec}
+}
+
+// A TypedStream consumes events like a StreamAPI, but decodes the events of each batch into values of
+// type T.
+type TypedStream[T any] struct {
+	source eventSource
+	codec  Codec
+}
+
+// NextEvents reads the next batch of events from the stream and returns the decoded events along with the
+// respective cursor. If one of the events can't be decoded, an EventDecodeError is returned along with the
+// cursor of the batch. Use NextRawEvents in order to handle such events individually.
+func (s *TypedStream[T]) NextEvents() (Cursor, []T, error) {
+	return s.NextEventsContext(context.Background())
+}
+
+// NextEventsContext is like NextEvents but stops waiting for the next batch of events once ctx is done.
+func (s *TypedStream[T]) NextEventsContext(ctx context.Context) (Cursor, []T, error) {
+	cursor, data, err := s.source.NextEventsContext(ctx)
+	if err != nil {
+		return cursor, nil, err
+	}
+	events, err := DecodeEvents[T](data, s.codec)
+	return cursor, events, err
+}
+
+// NextRawEvents reads the next batch of events from the stream and returns the events without decoding
+// them. Each event can be decoded individually, which allows to handle events that can't be decoded
+// without failing the whole batch.
+func (s *TypedStream[T]) NextRawEvents() (Cursor, []RawEvent[T], error) {
+	return s.NextRawEventsContext(context.Background())
+}
+
+// NextRawEventsContext is like NextRawEvents but stops waiting for the next batch of events once ctx is
+// done.
+func (s *TypedStream[T]) NextRawEventsContext(ctx context.Context) (Cursor, []RawEvent[T], error) {
+	cursor, data, err := s.source.NextEventsContext(ctx)
+	if err != nil {
+		return cursor, nil, err
+	}
+	messages, err := splitEvents(data, s.codec)
+	if err != nil {
+		return cursor, nil, err
+	}
+	events := make([]RawEvent[T], len(messages))
+	for i, message := range messages {
+		events[i] = RawEvent[T]{Data: message, codec: s.codec}
+	}
+	return cursor, events, nil
+}
+
+// CommitCursor commits a cursor to Nakadi.
+func (s *TypedStream[T]) CommitCursor(cursor Cursor) error {
+	return s.source.CommitCursor(cursor)
+}
+
+// Close ends the stream.
+func (s *TypedStream[T]) Close() error {
+	return s.source.Close()
+}
+
+// RawEvent is a single event which was not decoded yet.
+type RawEvent[T any] struct {
+	Data  json.RawMessage
+	codec Codec
+}
+
+// Decode decodes the event into a value of type T.
+func (e RawEvent[T]) Decode() (T, error) {
+	var event T
+	if err := e.getCodec().Unmarshal(e.Data, &event); err != nil {
+		return event, errors.Wrap(err, "unable to decode event")
+	}
+	return event, nil
+}
+
+// Metadata decodes only the metadata of the event.
+func (e RawEvent[T]) Metadata() (EventMetadata, error) {
+	var event UndefinedEvent
+	if err := e.getCodec().Unmarshal(e.Data, &event); err != nil {
+		return EventMetadata{}, errors.Wrap(err, "unable to decode event metadata")
+	}
+	return event.Metadata, nil
+}
+
+func (e RawEvent[T]) getCodec() Codec {
+	if e.codec == nil {
+		return jsonCodec{}
+	}
+	return e.codec
+}
+
+// EventDecodeError is returned when an event of a batch can't be decoded.
+type EventDecodeError struct {
+	// Index is the position of the event in the batch
+	Index int
+	Err   error
+}
+
+func (e *EventDecodeError) Error() string {
+	return errors.Wrapf(e.Err, "unable to decode event %d", e.Index).Error()
+}
+
+// Cause returns the underlying error.
+func (e *EventDecodeError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *EventDecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeEvents decodes a batch of events as returned by StreamAPI.NextEvents into a slice of T. If codec is
+// nil, encoding/json is used. If one of the events can't be decoded, an EventDecodeError is returned.
+func DecodeEvents[T any](events []byte, codec Codec) ([]T, error) {
+	if codec == nil {
+		codec = jsonCodec{}
+	}
+	messages, err := splitEvents(events, codec)
+	if err != nil {
+		return nil, err
+	}
+	decoded := make([]T, len(messages))
+	for i, message := range messages {
+		if err := codec.Unmarshal(message, &decoded[i]); err != nil {
+			return nil, &EventDecodeError{Index: i, Err: err}
+		}
+	}
+	return decoded, nil
+}
+
+// splitEvents splits a batch of events into the encoded single events.
+func splitEvents(events []byte, codec Codec) ([]json.RawMessage, error) {
+	if len(events) == 0 {
+		return nil, nil
+	}
+	var messages []json.RawMessage
+	if err := codec.Unmarshal(events, &messages); err != nil {
+		return nil, errors.Wrap(err, "unable to decode batch of events")
+	}
+	return messages, nil
+}
@@ -0,0 +1,173 @@
+package nakadi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type testTypedEvent struct {
+	UndefinedEvent
+	OrderNumber string `json:"order_number"`
+}
+
+const testTypedBatch = `[
+	{"metadata":{"eid":"1","occurred_at":"2017-08-12T07:11:58Z"},"order_number":"A1"},
+	{"metadata":{"eid":"2","occurred_at":"2017-08-12T07:11:59Z"},"order_number":42},
+	{"metadata":{"eid":"3","occurred_at":"2017-08-12T07:12:00Z"},"order_number":"A3"}]`
+
+func TestDecodeEvents(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		events, err := DecodeEvents[testTypedEvent]([]byte(`[{"metadata":{"eid":"1"},"order_number":"A1"}]`), nil)
+
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, "1", events[0].Metadata.EID)
+		assert.Equal(t, "A1", events[0].OrderNumber)
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		events, err := DecodeEvents[testTypedEvent](nil, nil)
+
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("fail invalid batch", func(t *testing.T) {
+		_, err := DecodeEvents[testTypedEvent]([]byte(`{}`), nil)
+
+		require.Error(t, err)
+		assert.Regexp(t, "unable to decode batch of events", err)
+	})
+
+	t.Run("fail invalid event", func(t *testing.T) {
+		_, err := DecodeEvents[testTypedEvent]([]byte(testTypedBatch), nil)
+
+		require.Error(t, err)
+		var decodeErr *EventDecodeError
+		require.True(t, errors.As(err, &decodeErr))
+		assert.Equal(t, 1, decodeErr.Index)
+		assert.Regexp(t, "unable to decode event 1", err)
+	})
+
+	t.Run("custom codec", func(t *testing.T) {
+		codec := &countingCodec{}
+		_, err := DecodeEvents[testTypedEvent]([]byte(`[{"order_number":"A1"},{"order_number":"A2"}]`), codec)
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, codec.calls)
+	})
+}
+
+func TestTypedStream(t *testing.T) {
+	cursor := Cursor{Partition: "0", Offset: "3", NakadiStreamID: "stream-id"}
+	setupStream := func() (*TypedStream[testTypedEvent], *mockEventSource) {
+		source := &mockEventSource{}
+		return &TypedStream[testTypedEvent]{source: source, codec: jsonCodec{}}, source
+	}
+
+	t.Run("next events", func(t *testing.T) {
+		stream, source := setupStream()
+		source.On("NextEventsContext").Once().Return(cursor, []byte(`[{"metadata":{"eid":"1"},"order_number":"A1"}]`), nil)
+
+		next, events, err := stream.NextEvents()
+
+		require.NoError(t, err)
+		assert.Equal(t, cursor, next)
+		require.Len(t, events, 1)
+		assert.Equal(t, "A1", events[0].OrderNumber)
+	})
+
+	t.Run("fail next events", func(t *testing.T) {
+		stream, source := setupStream()
+		source.On("NextEventsContext").Once().Return(Cursor{}, nil, assert.AnError)
+
+		_, _, err := stream.NextEvents()
+
+		assert.Equal(t, assert.AnError, err)
+	})
+
+	t.Run("next raw events", func(t *testing.T) {
+		stream, source := setupStream()
+		source.On("NextEventsContext").Once().Return(cursor, []byte(testTypedBatch), nil)
+
+		next, events, err := stream.NextRawEvents()
+
+		require.NoError(t, err)
+		assert.Equal(t, cursor, next)
+		require.Len(t, events, 3)
+
+		event, err := events[0].Decode()
+		require.NoError(t, err)
+		assert.Equal(t, "A1", event.OrderNumber)
+
+		_, err = events[1].Decode()
+		require.Error(t, err)
+		metadata, err := events[1].Metadata()
+		require.NoError(t, err)
+		assert.Equal(t, "2", metadata.EID)
+	})
+
+	t.Run("next raw events with context", func(t *testing.T) {
+		stream, source := setupStream()
+		source.On("NextEventsContext").Once().Return(Cursor{}, nil, context.Canceled)
+
+		_, events, err := stream.NextRawEventsContext(context.Background())
+
+		assert.Equal(t, context.Canceled, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("commit and close", func(t *testing.T) {
+		stream, source := setupStream()
+		source.On("CommitCursor", cursor).Once().Return(nil)
+		source.On("Close").Once().Return(assert.AnError)
+
+		assert.NoError(t, stream.CommitCursor(cursor))
+		assert.Equal(t, assert.AnError, stream.Close())
+		source.AssertExpectations(t)
+	})
+}
+
+func TestRawEvent_zeroValue(t *testing.T) {
+	event := RawEvent[testTypedEvent]{Data: json.RawMessage(`{"order_number":"A1"}`)}
+
+	decoded, err := event.Decode()
+
+	require.NoError(t, err)
+	assert.Equal(t, "A1", decoded.OrderNumber)
+}
+
+type countingCodec struct {
+	calls int
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	c.calls++
+	return json.Unmarshal(data, v)
+}
+
+type mockEventSource struct {
+	mock.Mock
+}
+
+func (s *mockEventSource) NextEventsContext(_ context.Context) (Cursor, []byte, error) {
+	args := s.Called()
+	if args.Error(2) != nil {
+		return Cursor{}, nil, args.Error(2)
+	}
+	return args.Get(0).(Cursor), args.Get(1).([]byte), nil
+}
+
+func (s *mockEventSource) CommitCursor(cursor Cursor) error {
+	return s.Called(cursor).Error(0)
+}
+
+func (s *mockEventSource) Close() error {
+	return s.Called().Error(0)
+}